@@ -0,0 +1,21 @@
+//go:build linux || darwin || freebsd
+
+package mon
+
+import (
+	"fmt"
+	"syscall"
+)
+
+func statfs(path string) (fsStats, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return fsStats{}, fmt.Errorf("statfs %s: %w", path, err)
+	}
+	return fsStats{
+		total:     uint64(st.Blocks) * uint64(st.Bsize),
+		avail:     uint64(st.Bavail) * uint64(st.Bsize),
+		files:     uint64(st.Files),
+		filesFree: uint64(st.Ffree),
+	}, nil
+}
@@ -0,0 +1,12 @@
+//go:build !(linux || darwin || freebsd)
+
+package mon
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func statfs(path string) (fsStats, error) {
+	return fsStats{}, fmt.Errorf("disk checks are not supported on %s", runtime.GOOS)
+}
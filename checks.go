@@ -0,0 +1,235 @@
+package mon
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Ready-made checks to be used with Status.RunCheck()
+
+// CheckTCP checks whether TCP connection to addr can be established
+func CheckTCP(addr string) CheckFunc {
+	return func(ctx context.Context) (State, string) {
+		start := time.Now()
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return StateCritical, err.Error()
+		}
+		conn.Close()
+		return StateOk, fmt.Sprintf("connected to %s in %s", addr, time.Since(start).Round(time.Microsecond))
+	}
+}
+
+// HTTPCheckConfig configures HTTP check
+type HTTPCheckConfig struct {
+	URL string
+	// HTTP method, defaults to GET
+	Method string
+	// Expected status code, defaults to any 2xx
+	ExpectedStatus int
+	// Expected substring of the response body, optional
+	ExpectedBody string
+	// HTTP client to use, defaults to http.DefaultClient; timeout is handled via check's context
+	Client *http.Client
+}
+
+// CheckHTTP checks whether URL returns expected status code and, optionally, body
+func CheckHTTP(cfg HTTPCheckConfig) CheckFunc {
+	if cfg.Method == "" {
+		cfg.Method = http.MethodGet
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	return func(ctx context.Context) (State, string) {
+		start := time.Now()
+		req, err := http.NewRequestWithContext(ctx, cfg.Method, cfg.URL, nil)
+		if err != nil {
+			return StateUnknown, err.Error()
+		}
+		resp, err := cfg.Client.Do(req)
+		if err != nil {
+			return StateCritical, err.Error()
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		if err != nil {
+			return StateCritical, fmt.Sprintf("error reading body: %s", err)
+		}
+		took := time.Since(start).Round(time.Microsecond)
+		if cfg.ExpectedStatus > 0 && resp.StatusCode != cfg.ExpectedStatus {
+			return StateCritical, fmt.Sprintf("HTTP %d, expected %d", resp.StatusCode, cfg.ExpectedStatus)
+		}
+		if cfg.ExpectedStatus == 0 && (resp.StatusCode < 200 || resp.StatusCode > 299) {
+			return StateCritical, fmt.Sprintf("HTTP %d", resp.StatusCode)
+		}
+		if cfg.ExpectedBody != "" && !strings.Contains(string(body), cfg.ExpectedBody) {
+			return StateCritical, fmt.Sprintf("HTTP %d, body does not contain [%s]", resp.StatusCode, cfg.ExpectedBody)
+		}
+		return StateOk, fmt.Sprintf("HTTP %d in %s", resp.StatusCode, took)
+	}
+}
+
+// CheckDNS checks whether name resolves. Resolver defaults to net.DefaultResolver
+func CheckDNS(name string, resolver ...*net.Resolver) CheckFunc {
+	r := net.DefaultResolver
+	if len(resolver) > 0 && resolver[0] != nil {
+		r = resolver[0]
+	}
+	return func(ctx context.Context) (State, string) {
+		addrs, err := r.LookupHost(ctx, name)
+		if err != nil {
+			return StateCritical, err.Error()
+		}
+		if len(addrs) == 0 {
+			return StateCritical, fmt.Sprintf("%s resolved to no addresses", name)
+		}
+		return StateOk, fmt.Sprintf("%s resolves to %s", name, strings.Join(addrs, ", "))
+	}
+}
+
+// Pinger is anything that can be pinged, like *sql.DB
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// CheckSQL checks database connection via PingContext of *sql.DB (or anything else implementing Pinger)
+func CheckSQL(db Pinger) CheckFunc {
+	return func(ctx context.Context) (State, string) {
+		start := time.Now()
+		if err := db.PingContext(ctx); err != nil {
+			return StateCritical, err.Error()
+		}
+		return StateOk, fmt.Sprintf("ping ok in %s", time.Since(start).Round(time.Microsecond))
+	}
+}
+
+// CheckDiskFree checks percentage of free space on filesystem containing path.
+// Check is Warning/Critical when free space is below given percentage
+func CheckDiskFree(path string, warnPercent float64, critPercent float64) CheckFunc {
+	return func(ctx context.Context) (State, string) {
+		st, err := statfs(path)
+		if err != nil {
+			return StateUnknown, err.Error()
+		}
+		if st.total == 0 {
+			return StateUnknown, fmt.Sprintf("%s: filesystem reports zero size", path)
+		}
+		free := float64(st.avail) / float64(st.total) * 100
+		msg := fmt.Sprintf("%s: %.1f%% free (%s of %s)", path, free, humanBytes(st.avail), humanBytes(st.total))
+		return thresholdBelow(free, warnPercent, critPercent), msg
+	}
+}
+
+// CheckInodesFree checks percentage of free inodes on filesystem containing path.
+// Check is Warning/Critical when free inodes are below given percentage
+func CheckInodesFree(path string, warnPercent float64, critPercent float64) CheckFunc {
+	return func(ctx context.Context) (State, string) {
+		st, err := statfs(path)
+		if err != nil {
+			return StateUnknown, err.Error()
+		}
+		// some filesystems (btrfs, some network ones) do not have fixed amount of inodes
+		if st.files == 0 {
+			return StateOk, fmt.Sprintf("%s: filesystem does not report inodes", path)
+		}
+		free := float64(st.filesFree) / float64(st.files) * 100
+		msg := fmt.Sprintf("%s: %.1f%% inodes free (%d of %d)", path, free, st.filesFree, st.files)
+		return thresholdBelow(free, warnPercent, critPercent), msg
+	}
+}
+
+// CheckFileAge checks whether file exists and was modified within given time, for example heartbeat file of a cron job.
+// Zero age disables given threshold, so with both at zero it only checks for file existence
+func CheckFileAge(path string, warnAge time.Duration, critAge time.Duration) CheckFunc {
+	return func(ctx context.Context) (State, string) {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return StateCritical, err.Error()
+		}
+		age := time.Since(fi.ModTime())
+		msg := fmt.Sprintf("%s: modified %s ago", path, age.Round(time.Second))
+		switch {
+		case critAge > 0 && age > critAge:
+			return StateCritical, msg
+		case warnAge > 0 && age > warnAge:
+			return StateWarning, msg
+		}
+		return StateOk, msg
+	}
+}
+
+// CheckTLSCert connects to addr (host:port) and checks whether certificate is valid and expires no sooner than given durations.
+// tlsConfig is optional, ServerName defaults to host part of addr
+func CheckTLSCert(addr string, warnBefore time.Duration, critBefore time.Duration, tlsConfig ...*tls.Config) CheckFunc {
+	cfg := &tls.Config{}
+	if len(tlsConfig) > 0 && tlsConfig[0] != nil {
+		cfg = tlsConfig[0].Clone()
+	}
+	if cfg.ServerName == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err == nil {
+			cfg.ServerName = host
+		}
+	}
+	return func(ctx context.Context) (State, string) {
+		d := tls.Dialer{Config: cfg}
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return StateCritical, err.Error()
+		}
+		defer conn.Close()
+		certs := conn.(*tls.Conn).ConnectionState().PeerCertificates
+		if len(certs) == 0 {
+			return StateCritical, fmt.Sprintf("%s: no certificate", addr)
+		}
+		cert := certs[0]
+		left := time.Until(cert.NotAfter)
+		msg := fmt.Sprintf("%s: certificate [%s] expires in %s (%s)", addr, cert.Subject.CommonName, left.Round(time.Hour), cert.NotAfter.Format(time.RFC3339))
+		switch {
+		case left < critBefore:
+			return StateCritical, msg
+		case left < warnBefore:
+			return StateWarning, msg
+		}
+		return StateOk, msg
+	}
+}
+
+func thresholdBelow(v float64, warn float64, crit float64) State {
+	switch {
+	case v < crit:
+		return StateCritical
+	case v < warn:
+		return StateWarning
+	}
+	return StateOk
+}
+
+type fsStats struct {
+	total     uint64
+	avail     uint64
+	files     uint64
+	filesFree uint64
+}
+
+func humanBytes(b uint64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := uint64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
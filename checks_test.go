@@ -0,0 +1,145 @@
+package mon
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	state, msg := CheckTCP(addr)(context.Background())
+	assert.Equal(t, StateOk, state, msg)
+	assert.Contains(t, msg, addr)
+	l.Close()
+	state, msg = CheckTCP(addr)(context.Background())
+	assert.Equal(t, StateCritical, state, msg)
+}
+
+func TestCheckHTTP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		fmt.Fprint(w, "pong")
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	state, msg := CheckHTTP(HTTPCheckConfig{URL: srv.URL + "/ping"})(ctx)
+	assert.Equal(t, StateOk, state, msg)
+	assert.Contains(t, msg, "HTTP 200")
+
+	state, msg = CheckHTTP(HTTPCheckConfig{URL: srv.URL + "/fail"})(ctx)
+	assert.Equal(t, StateCritical, state)
+	assert.Equal(t, "HTTP 503", msg)
+
+	state, _ = CheckHTTP(HTTPCheckConfig{URL: srv.URL + "/fail", ExpectedStatus: 503})(ctx)
+	assert.Equal(t, StateOk, state)
+
+	state, msg = CheckHTTP(HTTPCheckConfig{URL: srv.URL + "/ping", ExpectedStatus: 204})(ctx)
+	assert.Equal(t, StateCritical, state)
+	assert.Equal(t, "HTTP 200, expected 204", msg)
+
+	state, _ = CheckHTTP(HTTPCheckConfig{URL: srv.URL + "/ping", ExpectedBody: "pong"})(ctx)
+	assert.Equal(t, StateOk, state)
+	state, msg = CheckHTTP(HTTPCheckConfig{URL: srv.URL + "/ping", ExpectedBody: "ping"})(ctx)
+	assert.Equal(t, StateCritical, state)
+	assert.Contains(t, msg, "does not contain")
+
+	state, _ = CheckHTTP(HTTPCheckConfig{URL: "http://127.0.0.1:1/"})(ctx)
+	assert.Equal(t, StateCritical, state)
+}
+
+func TestCheckDNS(t *testing.T) {
+	state, msg := CheckDNS("localhost")(context.Background())
+	assert.Equal(t, StateOk, state, msg)
+	state, msg = CheckDNS("nonexistent.invalid")(context.Background())
+	assert.Equal(t, StateCritical, state, msg)
+}
+
+type testPinger struct{ err error }
+
+func (p testPinger) PingContext(ctx context.Context) error { return p.err }
+
+func TestCheckSQL(t *testing.T) {
+	state, _ := CheckSQL(testPinger{})(context.Background())
+	assert.Equal(t, StateOk, state)
+	state, msg := CheckSQL(testPinger{err: errors.New("connection refused")})(context.Background())
+	assert.Equal(t, StateCritical, state)
+	assert.Equal(t, "connection refused", msg)
+}
+
+func TestCheckDiskFree(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := statfs(dir); err != nil {
+		t.Skip(err)
+	}
+	state, msg := CheckDiskFree(dir, 0, 0)(context.Background())
+	assert.Equal(t, StateOk, state, msg)
+	assert.Contains(t, msg, "% free")
+	state, _ = CheckDiskFree(dir, 101, 0)(context.Background())
+	assert.Equal(t, StateWarning, state)
+	state, _ = CheckDiskFree(dir, 101, 101)(context.Background())
+	assert.Equal(t, StateCritical, state)
+	state, _ = CheckDiskFree(filepath.Join(dir, "nonexistent"), 0, 0)(context.Background())
+	assert.Equal(t, StateUnknown, state)
+
+	state, msg = CheckInodesFree(dir, 0, 0)(context.Background())
+	assert.Equal(t, StateOk, state, msg)
+}
+
+func TestCheckFileAge(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "heartbeat")
+	state, _ := CheckFileAge(file, 0, 0)(context.Background())
+	assert.Equal(t, StateCritical, state)
+	require.NoError(t, os.WriteFile(file, nil, 0o644))
+	state, _ = CheckFileAge(file, time.Minute, time.Hour)(context.Background())
+	assert.Equal(t, StateOk, state)
+	old := time.Now().Add(-time.Minute * 10)
+	require.NoError(t, os.Chtimes(file, old, old))
+	state, msg := CheckFileAge(file, time.Minute, time.Hour)(context.Background())
+	assert.Equal(t, StateWarning, state)
+	assert.Contains(t, msg, "modified 10m0s ago")
+	state, _ = CheckFileAge(file, 0, time.Minute)(context.Background())
+	assert.Equal(t, StateCritical, state)
+}
+
+func TestCheckTLSCert(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	addr := strings.TrimPrefix(srv.URL, "https://")
+	ctx := context.Background()
+	state, _ := CheckTLSCert(addr, time.Hour, time.Hour)(ctx)
+	assert.Equal(t, StateCritical, state, "self-signed cert should fail verification")
+
+	cfg := &tls.Config{RootCAs: srv.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs, ServerName: "example.com"}
+	state, msg := CheckTLSCert(addr, time.Hour, time.Hour, cfg)(ctx)
+	assert.Equal(t, StateOk, state, msg)
+	assert.Contains(t, msg, "expires in")
+	notAfter := srv.Certificate().NotAfter
+	state, _ = CheckTLSCert(addr, time.Until(notAfter)+time.Hour, time.Hour, cfg)(ctx)
+	assert.Equal(t, StateWarning, state)
+	state, _ = CheckTLSCert(addr, 0, time.Until(notAfter)+time.Hour, cfg)(ctx)
+	assert.Equal(t, StateCritical, state)
+}
+
+func TestHumanBytes(t *testing.T) {
+	assert.Equal(t, "512 B", humanBytes(512))
+	assert.Equal(t, "1.5 KiB", humanBytes(1536))
+	assert.Equal(t, "2.0 GiB", humanBytes(2<<30))
+}
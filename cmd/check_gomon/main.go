@@ -0,0 +1,263 @@
+// check_gomon is nagios/icinga plugin checking go-mon's health and metrics endpoints
+//
+//	check_gomon -health http://app:8080/_status/health -max-age 5m \
+//	    -metrics http://app:8080/_status/metrics -metric 'web.concurrent_connections;100;200'
+//
+// metric thresholds are in `name;warning;critical` format, with nagios ranges as thresholds.
+// Name selects all series of the metric; series with labels are reported as `name_key1_value1_key2_value2`
+// (keys sorted) and can be selected by that label, e.g. `-metric 'haproxy.queue_backend_bck_lb_node_lb1;5;10'`
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/efigence/go-mon"
+)
+
+type metricFlag []string
+
+func (m *metricFlag) String() string {
+	return strings.Join(*m, ",")
+}
+
+func (m *metricFlag) Set(v string) error {
+	*m = append(*m, v)
+	return nil
+}
+
+type config struct {
+	healthURL  string
+	metricsURL string
+	maxAge     time.Duration
+	timeout    time.Duration
+	insecure   bool
+	metrics    metricFlag
+}
+
+// registry as returned by metrics endpoint
+type registryJSON struct {
+	Metrics map[string]map[string]mon.JSONOut `json:"metrics"`
+	Ts      time.Time                         `json:"ts"`
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout))
+}
+
+func run(args []string, out io.Writer) int {
+	var cfg config
+	fs := flag.NewFlagSet("check_gomon", flag.ContinueOnError)
+	fs.SetOutput(out)
+	fs.StringVar(&cfg.healthURL, "health", "", "URL of health endpoint, e.g. http://127.0.0.1:8080/_status/health")
+	fs.StringVar(&cfg.metricsURL, "metrics", "", "URL of metrics endpoint, e.g. http://127.0.0.1:8080/_status/metrics")
+	fs.DurationVar(&cfg.maxAge, "max-age", 0, "maximum age of status and its components, 0 disables staleness check")
+	fs.DurationVar(&cfg.timeout, "timeout", time.Second*10, "HTTP timeout")
+	fs.BoolVar(&cfg.insecure, "insecure", false, "do not verify TLS certificates")
+	fs.Var(&cfg.metrics, "metric", "metric to check, 'name;warning;critical' (thresholds optional, can be repeated). Use 'name_key_value' to select series with labels")
+	if err := fs.Parse(args); err != nil {
+		return mon.StateUnknown.NagiosCode()
+	}
+	result := check(cfg)
+	fmt.Fprint(out, result.String())
+	return result.ExitCode()
+}
+
+func check(cfg config) mon.NagiosResult {
+	if cfg.healthURL == "" && cfg.metricsURL == "" {
+		return mon.NagiosResult{State: mon.StateUnknown, Message: "at least one of -health or -metrics is required"}
+	}
+	if len(cfg.metrics) > 0 && cfg.metricsURL == "" {
+		return mon.NagiosResult{State: mon.StateUnknown, Message: "-metric requires -metrics URL"}
+	}
+	client := &http.Client{Timeout: cfg.timeout}
+	if cfg.insecure {
+		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	}
+	result := mon.NagiosResult{State: mon.StateOk, Message: "metrics ok"}
+	if cfg.healthURL != "" {
+		var status mon.Status
+		if err := fetch(client, cfg.healthURL, &status); err != nil {
+			return mon.NagiosResult{State: mon.StateCritical, Message: err.Error()}
+		}
+		result = checkStatus(&status, cfg.maxAge)
+	}
+	if cfg.metricsURL != "" {
+		var registry registryJSON
+		if err := fetch(client, cfg.metricsURL, &registry); err != nil {
+			result.Raise(mon.StateCritical, err.Error())
+			return result
+		}
+		checkMetrics(&result, &registry, cfg.metrics)
+	}
+	return result
+}
+
+// fetch decodes JSON from url. Health endpoint returns non-200 codes on failure but still have valid body so code is not checked
+func fetch(client *http.Client, url string, v interface{}) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return fmt.Errorf("error fetching %s: %s", url, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return fmt.Errorf("error reading %s: %s", url, err)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("error decoding response from %s (HTTP %d): %s", url, resp.StatusCode, err)
+	}
+	return nil
+}
+
+func checkStatus(status *mon.Status, maxAge time.Duration) mon.NagiosResult {
+	result := mon.NewNagiosResult(status)
+	if status.State == mon.StateInvalid || status.Name == "" {
+		result.Raise(mon.StateUnknown, "invalid status data")
+	}
+	if maxAge > 0 {
+		checkStale(&result, status, status.Name, maxAge)
+	}
+	return result
+}
+
+func checkStale(result *mon.NagiosResult, s *mon.Status, path string, maxAge time.Duration) {
+	if len(s.Components) == 0 {
+		if age := time.Since(s.Ts); age > maxAge {
+			result.Raise(mon.StateUnknown, fmt.Sprintf("%s: stale, last update %s ago", path, age.Truncate(time.Second)))
+		}
+		return
+	}
+	names := make([]string, 0, len(s.Components))
+	for name := range s.Components {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		checkStale(result, s.Components[name], path+"/"+name, maxAge)
+	}
+}
+
+func checkMetrics(result *mon.NagiosResult, registry *registryJSON, metrics []string) {
+	for _, m := range metrics {
+		parts := strings.Split(m, ";")
+		name := parts[0]
+		var warning, critical string
+		if len(parts) > 1 {
+			warning = parts[1]
+		}
+		if len(parts) > 2 {
+			critical = parts[2]
+		}
+		series, err := findSeries(registry, name)
+		if err != nil {
+			result.Raise(mon.StateUnknown, err.Error())
+			continue
+		}
+		if len(series) == 0 {
+			result.Raise(mon.StateUnknown, "no such metric: "+name)
+			continue
+		}
+		for _, s := range series {
+			v, ok := s.metric.Value.(float64)
+			if !ok || s.metric.Invalid {
+				result.Raise(mon.StateUnknown, s.label+": invalid value")
+				continue
+			}
+			value, uom := mon.NagiosUnit(v, s.metric.Unit, s.metric.Type)
+			err := result.AddPerf(mon.NagiosPerf{
+				Label:    s.label,
+				Value:    value,
+				UOM:      uom,
+				Warning:  warning,
+				Critical: critical,
+			})
+			if err != nil {
+				result.Raise(mon.StateUnknown, err.Error())
+			}
+		}
+	}
+}
+
+type series struct {
+	label  string
+	metric mon.JSONOut
+}
+
+// findSeries returns all series of the metric, sorted by label, or single series matching `name_key_value` label
+func findSeries(registry *registryJSON, name string) ([]series, error) {
+	if m, ok := registry.Metrics[name]; ok {
+		return metricSeries(name, m)
+	}
+	for metricName, m := range registry.Metrics {
+		if !strings.HasPrefix(name, metricName+"_") {
+			continue
+		}
+		all, err := metricSeries(metricName, m)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range all {
+			if s.label == name {
+				return []series{s}, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// metricSeries returns series of the metric labelled `name_key1_value1_key2_value2`, or just name if series has no labels
+func metricSeries(name string, m map[string]mon.JSONOut) ([]series, error) {
+	out := make([]series, 0, len(m))
+	for key, metric := range m {
+		labels, err := parseLabels(key)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err)
+		}
+		label := name
+		for _, l := range labels {
+			label += "_" + l[0] + "_" + l[1]
+		}
+		out = append(out, series{label: label, metric: metric})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].label < out[j].label })
+	return out, nil
+}
+
+// parseLabels parses `key="value",...` series key
+func parseLabels(key string) (labels [][2]string, err error) {
+	for key != "" {
+		eq := strings.Index(key, `="`)
+		if eq < 1 {
+			return nil, fmt.Errorf("invalid labels [%s]", key)
+		}
+		name := key[:eq]
+		key = key[eq+2:]
+		var value strings.Builder
+		i := 0
+		for ; i < len(key) && key[i] != '"'; i++ {
+			if key[i] == '\\' && i+1 < len(key) {
+				i++
+				if key[i] == 'n' {
+					value.WriteByte('\n')
+					continue
+				}
+			}
+			value.WriteByte(key[i])
+		}
+		if i == len(key) {
+			return nil, fmt.Errorf("unterminated label value [%s]", name)
+		}
+		labels = append(labels, [2]string{name, value.String()})
+		key = strings.TrimPrefix(key[i+1:], ",")
+	}
+	return labels, nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/efigence/go-mon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testServer(t *testing.T, status *mon.Status, registry *mon.Registry) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/_status/health", func(w http.ResponseWriter, req *http.Request) {
+		js, err := json.Marshal(snapshot(status))
+		require.NoError(t, err)
+		if status.GetState() != mon.StateOk {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		w.Write(js)
+	})
+	mux.HandleFunc("/_status/metrics", func(w http.ResponseWriter, req *http.Request) {
+		js, err := json.Marshal(registry.GetRegistry())
+		require.NoError(t, err)
+		w.Write(js)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// snapshot copies status tree under each component's lock, as status is updated in the background while the server renders it
+func snapshot(s *mon.Status) *mon.Status {
+	s.RLock()
+	out := &mon.Status{
+		State: s.State,
+		Name:  s.Name,
+		Msg:   s.Msg,
+		Ok:    s.Ok,
+		Ts:    s.Ts,
+		Stale: s.Stale,
+	}
+	components := s.Components
+	s.RUnlock()
+	if len(components) > 0 {
+		out.Components = make(map[string]*mon.Status, len(components))
+		for name, c := range components {
+			out.Components[name] = snapshot(c)
+		}
+	}
+	return out
+}
+
+func TestParseLabels(t *testing.T) {
+	labels, err := parseLabels(`backend="bck",lb_node="lb\\1 \"a\"\n"`)
+	require.NoError(t, err)
+	assert.Equal(t, [][2]string{{"backend", "bck"}, {"lb_node", "lb\\1 \"a\"\n"}}, labels)
+	labels, err = parseLabels("")
+	require.NoError(t, err)
+	assert.Empty(t, labels)
+	for _, bad := range []string{"backend", `backend="bck`, `="x"`} {
+		_, err := parseLabels(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	status := mon.NewStatus("app")
+	db := status.MustNewComponent("db")
+	require.NoError(t, db.Update(mon.StateOk, "running"))
+	registry, err := mon.NewRegistry("", "app", 10)
+	require.NoError(t, err)
+	registry.MustRegister("web.concurrent_connections", mon.NewGauge()).Update(150)
+	registry.MustRegister("haproxy.queue", mon.NewGauge(), map[string]string{"lb_node": "lb1", "backend": "bck"}).Update(3)
+	registry.MustRegister("haproxy.queue", mon.NewGauge(), map[string]string{"lb_node": "lb2", "backend": "bck"}).Update(12)
+	srv := testServer(t, status, registry)
+	// wait for status propagation to the parent
+	time.Sleep(time.Millisecond * 10)
+
+	var out bytes.Buffer
+	code := run([]string{"-health", srv.URL + "/_status/health"}, &out)
+	assert.Equal(t, 0, code, out.String())
+	assert.True(t, strings.HasPrefix(out.String(), "OK - [db]running\n[OK] db: running"), out.String())
+
+	t.Run("metric thresholds", func(t *testing.T) {
+		var out bytes.Buffer
+		code := run([]string{
+			"-health", srv.URL + "/_status/health",
+			"-metrics", srv.URL + "/_status/metrics",
+			"-metric", "web.concurrent_connections;100;200",
+		}, &out)
+		assert.Equal(t, 1, code, out.String())
+		assert.Contains(t, out.String(), "| web.concurrent_connections=150;100;200\n")
+	})
+	t.Run("labelled series", func(t *testing.T) {
+		var out bytes.Buffer
+		code := run([]string{"-metrics", srv.URL + "/_status/metrics", "-metric", "haproxy.queue;5;10"}, &out)
+		assert.Equal(t, 2, code, out.String())
+		assert.Contains(t, out.String(), "| haproxy.queue_backend_bck_lb_node_lb1=3;5;10 haproxy.queue_backend_bck_lb_node_lb2=12;5;10\n")
+		assert.Contains(t, out.String(), "CRITICAL - haproxy.queue_backend_bck_lb_node_lb2=12 outside of 10")
+
+		out.Reset()
+		code = run([]string{"-metrics", srv.URL + "/_status/metrics", "-metric", "haproxy.queue_backend_bck_lb_node_lb1;5;10"}, &out)
+		assert.Equal(t, 0, code, out.String())
+		assert.Contains(t, out.String(), "| haproxy.queue_backend_bck_lb_node_lb1=3;5;10\n")
+
+		out.Reset()
+		code = run([]string{"-metrics", srv.URL + "/_status/metrics", "-metric", "haproxy.queue_backend_bck_lb_node_lb3"}, &out)
+		assert.Equal(t, 3, code, out.String())
+	})
+	t.Run("metric thresholds without health", func(t *testing.T) {
+		var out bytes.Buffer
+		code := run([]string{
+			"-metrics", srv.URL + "/_status/metrics",
+			"-metric", "web.concurrent_connections;100;120",
+		}, &out)
+		assert.Equal(t, 2, code, out.String())
+		assert.True(t, strings.HasPrefix(out.String(), "CRITICAL - web.concurrent_connections=150 outside of 120 |"), out.String())
+	})
+	t.Run("metrics unreachable", func(t *testing.T) {
+		var out bytes.Buffer
+		code := run([]string{"-health", srv.URL + "/_status/health", "-metrics", "http://127.0.0.1:1/_status/metrics"}, &out)
+		assert.Equal(t, 2, code, out.String())
+		assert.True(t, strings.HasPrefix(out.String(), "CRITICAL - error fetching http://127.0.0.1:1/_status/metrics"), out.String())
+	})
+	t.Run("missing metric", func(t *testing.T) {
+		var out bytes.Buffer
+		code := run([]string{"-metrics", srv.URL + "/_status/metrics", "-metric", "nonexistent"}, &out)
+		assert.Equal(t, 3, code, out.String())
+	})
+	t.Run("stale", func(t *testing.T) {
+		var out bytes.Buffer
+		time.Sleep(time.Millisecond * 20)
+		code := run([]string{"-health", srv.URL + "/_status/health", "-max-age", "10ms"}, &out)
+		assert.Equal(t, 3, code, out.String())
+		assert.Contains(t, out.String(), "app/db: stale")
+	})
+	t.Run("critical", func(t *testing.T) {
+		require.NoError(t, db.Update(mon.StateCritical, "connection refused"))
+		time.Sleep(time.Millisecond * 10)
+		var out bytes.Buffer
+		code := run([]string{"-health", srv.URL + "/_status/health"}, &out)
+		assert.Equal(t, 2, code, out.String())
+		assert.Contains(t, out.String(), "CRITICAL - C:[db]connection refused")
+	})
+	t.Run("unreachable", func(t *testing.T) {
+		var out bytes.Buffer
+		code := run([]string{"-health", "http://127.0.0.1:1/_status/health"}, &out)
+		assert.Equal(t, 2, code, out.String())
+	})
+	t.Run("no urls", func(t *testing.T) {
+		var out bytes.Buffer
+		assert.Equal(t, 3, run([]string{}, &out))
+	})
+}
@@ -0,0 +1,204 @@
+package mon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Icinga2Config configures pushing Status as passive check results to Icinga2 API
+type Icinga2Config struct {
+	// API URL, e.g. https://icinga.example.com:5665
+	URL string
+	// API user and password
+	User     string
+	Password string
+	// Host object name, defaults to Status' FQDN
+	Host string
+	// Service name for root status. If empty, root status is sent as host check result
+	Service string
+	// ServiceName maps component path to service name.
+	// Default joins service name and component path with ".", like "myapp.db"
+	ServiceName func(path []string) string
+	// Registry and its metrics to send as perfdata of root check result
+	Registry *Registry
+	Metrics  []NagiosMetric
+	// TTL of check result, after it expires Icinga will run check command of the object (usually dummy returning "stale" state).
+	// Defaults to 3 intervals
+	TTL time.Duration
+	// Check source reported to icinga, defaults to Host
+	CheckSource string
+	// HTTP client to use, defaults to client with 10s timeout
+	Client *http.Client
+	PushConfig
+}
+
+// Icinga2Reporter pushes Status tree to Icinga2's process-check-result action,
+// root as host or service check and each component as its own service
+type Icinga2Reporter struct {
+	cfg    Icinga2Config
+	status *Status
+	url    string
+}
+
+type icinga2CheckResult struct {
+	Type            string            `json:"type"`
+	Filter          string            `json:"filter"`
+	FilterVars      map[string]string `json:"filter_vars"`
+	ExitStatus      int               `json:"exit_status"`
+	PluginOutput    string            `json:"plugin_output"`
+	PerformanceData []string          `json:"performance_data,omitempty"`
+	CheckSource     string            `json:"check_source,omitempty"`
+	TTL             float64           `json:"ttl,omitempty"`
+}
+
+type icinga2Response struct {
+	Results []struct {
+		Code   float64 `json:"code"`
+		Status string  `json:"status"`
+	} `json:"results"`
+	Error  float64 `json:"error"`
+	Status string  `json:"status"`
+}
+
+func NewIcinga2Reporter(s *Status, cfg Icinga2Config) (*Icinga2Reporter, error) {
+	u, err := parsePushURL("Icinga2", cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/v1/actions/process-check-result"
+	if cfg.Host == "" {
+		cfg.Host = s.FQDN
+	}
+	if cfg.Host == "" {
+		return nil, fmt.Errorf("Icinga2 host name is required")
+	}
+	if cfg.ServiceName == nil {
+		service := cfg.Service
+		cfg.ServiceName = func(path []string) string {
+			if service == "" {
+				return strings.Join(path, ".")
+			}
+			return service + "." + strings.Join(path, ".")
+		}
+	}
+	cfg.setDefaults(time.Minute)
+	if cfg.TTL <= 0 {
+		cfg.TTL = cfg.Interval * 3
+	}
+	if cfg.CheckSource == "" {
+		cfg.CheckSource = cfg.Host
+	}
+	cfg.Client = defaultPushClient(cfg.Client)
+	return &Icinga2Reporter{
+		cfg:    cfg,
+		status: s,
+		url:    u.String(),
+	}, nil
+}
+
+// Push sends check results for root status and all of its components
+func (r *Icinga2Reporter) Push(ctx context.Context) error {
+	var errs []string
+	walkStatus(r.status, nil, func(path []string, s *Status) {
+		if err := r.push(ctx, path, s); err != nil {
+			errs = append(errs, err.Error())
+		}
+	})
+	if len(errs) > 0 {
+		return fmt.Errorf("icinga2 push failed: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (r *Icinga2Reporter) push(ctx context.Context, path []string, s *Status) error {
+	var result NagiosResult
+	if len(path) == 0 && r.cfg.Registry != nil {
+		result = RenderNagios(s, r.cfg.Registry, r.cfg.Metrics...)
+	} else {
+		result = NewNagiosResult(s)
+	}
+	check := icinga2CheckResult{
+		ExitStatus:  result.ExitCode(),
+		CheckSource: r.cfg.CheckSource,
+		TTL:         r.cfg.TTL.Seconds(),
+	}
+	for _, p := range result.Perfdata {
+		check.PerformanceData = append(check.PerformanceData, p.String())
+	}
+	result.Perfdata = nil
+	check.PluginOutput = strings.TrimSuffix(result.String(), "\n")
+	if len(path) == 0 && r.cfg.Service == "" {
+		check.Type = "Host"
+		check.Filter = "host.name==host"
+		check.FilterVars = map[string]string{"host": r.cfg.Host}
+		// hosts only have up (0) and down (1) states
+		if result.State == StateOk || result.State == StateWarning {
+			check.ExitStatus = 0
+		} else {
+			check.ExitStatus = 1
+		}
+	} else {
+		service := r.cfg.Service
+		if len(path) > 0 {
+			service = r.cfg.ServiceName(path)
+		}
+		check.Type = "Service"
+		check.Filter = "host.name==host && service.name==service"
+		check.FilterVars = map[string]string{"host": r.cfg.Host, "service": service}
+	}
+	return r.send(ctx, check)
+}
+
+func (r *Icinga2Reporter) send(ctx context.Context, check icinga2CheckResult) error {
+	body, err := json.Marshal(check)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	if r.cfg.User != "" {
+		req.SetBasicAuth(r.cfg.User, r.cfg.Password)
+	}
+	resp, err := r.cfg.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	name := check.FilterVars["host"]
+	if s, ok := check.FilterVars["service"]; ok {
+		name += "!" + s
+	}
+	var icingaResp icinga2Response
+	json.Unmarshal(data, &icingaResp)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		if icingaResp.Status != "" {
+			return fmt.Errorf("%s: %s: %s", name, resp.Status, icingaResp.Status)
+		}
+		return fmt.Errorf("%s: %s", name, resp.Status)
+	}
+	if len(icingaResp.Results) == 0 {
+		return fmt.Errorf("%s: no such object", name)
+	}
+	for _, res := range icingaResp.Results {
+		if res.Code < 200 || res.Code > 299 {
+			return fmt.Errorf("%s: %s", name, res.Status)
+		}
+	}
+	return nil
+}
+
+// Run pushes check results right away and then every interval until context is cancelled
+func (r *Icinga2Reporter) Run(ctx context.Context) error {
+	return r.cfg.run(ctx, r.Push)
+}
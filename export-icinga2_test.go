@@ -0,0 +1,138 @@
+package mon
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fake icinga2 API that knows only objects listed in known
+func icinga2TestServer(t *testing.T, known map[string]bool) (*httptest.Server, func() map[string]icinga2CheckResult) {
+	var lock sync.Mutex
+	results := map[string]icinga2CheckResult{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "/v1/actions/process-check-result", req.URL.Path)
+		user, pass, ok := req.BasicAuth()
+		if !ok || user != "root" || pass != "icinga" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var check icinga2CheckResult
+		require.NoError(t, json.NewDecoder(req.Body).Decode(&check))
+		name := check.FilterVars["host"]
+		if s, ok := check.FilterVars["service"]; ok {
+			name += "!" + s
+		}
+		if !known[name] {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":404,"status":"No objects found."}`))
+			return
+		}
+		lock.Lock()
+		results[name] = check
+		lock.Unlock()
+		w.Write([]byte(`{"results":[{"code":200.0,"status":"Successfully processed check result for object '` + name + `'."}]}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() map[string]icinga2CheckResult {
+		lock.Lock()
+		defer lock.Unlock()
+		return results
+	}
+}
+
+func TestIcinga2Reporter(t *testing.T) {
+	srv, results := icinga2TestServer(t, map[string]bool{
+		"app.example.com!myapp":       true,
+		"app.example.com!myapp.db":    true,
+		"app.example.com!myapp.cache": true,
+	})
+	s := NewStatus("myapp")
+	s.FQDN = "app.example.com"
+	db := s.MustNewComponent("db")
+	cache := s.MustNewComponent("cache")
+	require.NoError(t, db.Update(StateOk, "running"))
+	require.NoError(t, cache.Update(StateWarning, "evicting"))
+	r, err := NewRegistry("", "", 10)
+	require.NoError(t, err)
+	r.MustRegister("web.concurrent_connections", NewGauge()).Update(20)
+
+	reporter, err := NewIcinga2Reporter(s, Icinga2Config{
+		URL:      srv.URL,
+		User:     "root",
+		Password: "icinga",
+		Service:  "myapp",
+		Registry: r,
+		Metrics:  []NagiosMetric{{Name: "web.concurrent_connections", Label: "conns", Warning: "100"}},
+	})
+	require.NoError(t, err)
+	require.NoError(t, reporter.Push(context.Background()))
+	res := results()
+	require.Len(t, res, 3)
+	root := res["app.example.com!myapp"]
+	assert.Equal(t, "Service", root.Type)
+	assert.Equal(t, 1, root.ExitStatus)
+	assert.Equal(t, []string{"conns=20;100"}, root.PerformanceData)
+	assert.Equal(t, 180.0, root.TTL, "default TTL is 3 intervals")
+	assert.Equal(t, "app.example.com", root.CheckSource)
+	assert.Contains(t, root.PluginOutput, "WARNING - ")
+	assert.Contains(t, root.PluginOutput, "\n[OK] db: running")
+	assert.Equal(t, 0, res["app.example.com!myapp.db"].ExitStatus)
+	assert.Equal(t, "OK - running", res["app.example.com!myapp.db"].PluginOutput)
+	assert.Equal(t, 1, res["app.example.com!myapp.cache"].ExitStatus)
+	assert.Empty(t, res["app.example.com!myapp.cache"].PerformanceData)
+
+	t.Run("unknown object", func(t *testing.T) {
+		s.MustNewComponent("queue")
+		err := reporter.Push(context.Background())
+		assert.ErrorContains(t, err, "app.example.com!myapp.queue")
+		assert.ErrorContains(t, err, "No objects found")
+	})
+	t.Run("run", func(t *testing.T) {
+		errs := make(chan error, 1)
+		reporter, err := NewIcinga2Reporter(s, Icinga2Config{
+			URL:        srv.URL,
+			Service:    "myapp",
+			PushConfig: PushConfig{OnError: func(err error) { errs <- err }},
+		})
+		require.NoError(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go reporter.Run(ctx)
+		select {
+		case err := <-errs:
+			assert.ErrorContains(t, err, "myapp.queue", "Run pushes without waiting for interval")
+		case <-time.After(time.Second):
+			t.Fatal("no push after Run")
+		}
+	})
+}
+
+func TestIcinga2ReporterHost(t *testing.T) {
+	srv, results := icinga2TestServer(t, map[string]bool{
+		"app.example.com": true,
+	})
+	s := NewStatus("myapp")
+	require.NoError(t, s.Update(StateCritical, "down"))
+	reporter, err := NewIcinga2Reporter(s, Icinga2Config{
+		URL:      srv.URL,
+		User:     "root",
+		Password: "icinga",
+		Host:     "app.example.com",
+	})
+	require.NoError(t, err)
+	require.NoError(t, reporter.Push(context.Background()))
+	host := results()["app.example.com"]
+	assert.Equal(t, "Host", host.Type)
+	assert.Equal(t, 1, host.ExitStatus, "critical is host down")
+
+	_, err = NewIcinga2Reporter(NewStatus("nofqdn"), Icinga2Config{URL: srv.URL})
+	assert.Error(t, err, "host name is required")
+}
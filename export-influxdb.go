@@ -0,0 +1,191 @@
+package mon
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var influxMeasurementRepl = strings.NewReplacer(
+	",", `\,`,
+	" ", `\ `,
+	"\n", `\n`,
+)
+var influxTagRepl = strings.NewReplacer(
+	",", `\,`,
+	"=", `\=`,
+	" ", `\ `,
+	"\n", `\n`,
+)
+
+// WriteInfluxDB writes registry in InfluxDB line protocol.
+// Metric name is used as measurement, labels plus registry's fqdn and instance as tags, and value goes into `value` field.
+// Histograms also get `sum` and `count` fields
+func WriteInfluxDB(w io.Writer, registry *Registry) error {
+	snapshot := registry.GetRegistry()
+	ts := strconv.FormatInt(snapshot.Ts.UnixNano(), 10)
+	baseTags := map[string]string{}
+	if snapshot.FQDN != "" {
+		baseTags["fqdn"] = snapshot.FQDN
+	}
+	if snapshot.Instance != "" {
+		baseTags["instance"] = snapshot.Instance
+	}
+	names := make([]string, 0, len(snapshot.Metrics))
+	for name := range snapshot.Metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var lines []string
+	for _, name := range names {
+		var series []string
+		for gob, metric := range snapshot.Metrics[name] {
+			fields := influxFields(metric)
+			if fields == "" {
+				continue
+			}
+			series = append(series, influxMeasurementRepl.Replace(name)+influxTags(baseTags, gob)+" "+fields+" "+ts)
+		}
+		sort.Strings(series)
+		lines = append(lines, series...)
+	}
+	for _, l := range lines {
+		if _, err := io.WriteString(w, l+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func influxTags(base map[string]string, gob string) string {
+	tags := map[string]string{}
+	for k, v := range base {
+		tags[k] = v
+	}
+	if gob != string(emptyGob) {
+		for k, v := range ungobTag([]byte(gob)).T {
+			tags[k] = v
+		}
+	}
+	tagSlice := make([]string, 0, len(tags))
+	for k, v := range tags {
+		// empty tag values are not allowed in line protocol
+		if v == "" {
+			continue
+		}
+		tagSlice = append(tagSlice, influxTagRepl.Replace(k)+"="+influxTagRepl.Replace(v))
+	}
+	if len(tagSlice) == 0 {
+		return ""
+	}
+	// influx recommends sorting tags by key for performance
+	sort.Strings(tagSlice)
+	return "," + strings.Join(tagSlice, ",")
+}
+
+func influxFields(metric Metric) string {
+	v := metric.Value()
+	// line protocol does not support NaN and Inf
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return ""
+	}
+	fields := "value=" + strconv.FormatFloat(v, 'f', -1, 64)
+	if h, ok := metric.(Histogram); ok {
+		snap := h.HistogramSnapshot()
+		fields += ",sum=" + strconv.FormatFloat(snap.Sum, 'f', -1, 64) + ",count=" + strconv.FormatUint(snap.Count, 10) + "i"
+	}
+	return fields
+}
+
+// HandleInfluxDB returns GlobalRegistry in InfluxDB line protocol, for Telegraf's http input with data_format = "influx"
+func HandleInfluxDB(w http.ResponseWriter, req *http.Request) {
+	handleInfluxDB(w, req, GlobalRegistry)
+}
+
+func handleInfluxDB(w http.ResponseWriter, req *http.Request, registry *Registry) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	WriteInfluxDB(w, registry)
+}
+
+// InfluxDBConfig configures push to InfluxDB v2 write API (or any compatible endpoint)
+type InfluxDBConfig struct {
+	// Base URL of server, e.g. http://127.0.0.1:8086
+	URL string
+	// Organization name, sent as `org` parameter
+	Org string
+	// Bucket to write to, sent as `bucket` parameter
+	Bucket string
+	// API token, sent as `Authorization: Token ...` header if set
+	Token string
+	// HTTP client to use, defaults to client with 10s timeout
+	Client *http.Client
+	PushConfig
+}
+
+// InfluxDBExporter pushes registry to InfluxDB
+type InfluxDBExporter struct {
+	cfg      InfluxDBConfig
+	registry *Registry
+	writeURL string
+}
+
+func NewInfluxDBExporter(registry *Registry, cfg InfluxDBConfig) (*InfluxDBExporter, error) {
+	u, err := parsePushURL("InfluxDB", cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/api/v2/write"
+	q := u.Query()
+	if cfg.Org != "" {
+		q.Set("org", cfg.Org)
+	}
+	if cfg.Bucket != "" {
+		q.Set("bucket", cfg.Bucket)
+	}
+	q.Set("precision", "ns")
+	u.RawQuery = q.Encode()
+	cfg.setDefaults(registryInterval(registry))
+	cfg.Client = defaultPushClient(cfg.Client)
+	return &InfluxDBExporter{
+		cfg:      cfg,
+		registry: registry,
+		writeURL: u.String(),
+	}, nil
+}
+
+// Push sends current state of registry to InfluxDB
+func (e *InfluxDBExporter) Push(ctx context.Context) error {
+	var buf bytes.Buffer
+	if err := WriteInfluxDB(&buf, e.registry); err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.writeURL, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if e.cfg.Token != "" {
+		req.Header.Set("Authorization", "Token "+e.cfg.Token)
+	}
+	resp, err := e.cfg.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("InfluxDB write failed with %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// Run pushes metrics right away and then every interval until context is cancelled
+func (e *InfluxDBExporter) Run(ctx context.Context) error {
+	return e.cfg.run(ctx, e.Push)
+}
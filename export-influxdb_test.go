@@ -0,0 +1,98 @@
+package mon
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func influxTestRegistry(t *testing.T) *Registry {
+	r, err := NewRegistry("test.example.com", "app", 10)
+	require.NoError(t, err)
+	r.MustRegister("room", NewGauge("temperature"), map[string]string{"location": "server room"}).Update(23.4)
+	r.MustRegister("web.requests", NewCounter()).Update(10)
+	h := r.MustRegister("web.latency", NewHistogram(nil, "s"))
+	h.Update(1)
+	h.Update(2)
+	return r
+}
+
+func TestWriteInfluxDB(t *testing.T) {
+	r := influxTestRegistry(t)
+	var buf bytes.Buffer
+	require.NoError(t, WriteInfluxDB(&buf, r))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 3)
+	ts := lines[0][strings.LastIndex(lines[0], " ")+1:]
+	_, err := strconv.ParseInt(ts, 10, 64)
+	assert.NoError(t, err, "nanosecond timestamp")
+	assert.Equal(t, `room,fqdn=test.example.com,instance=app,location=server\ room value=23.4 `+ts, lines[0])
+	assert.Equal(t, `web.latency,fqdn=test.example.com,instance=app value=1.5,sum=3,count=2i `+ts, lines[1])
+	assert.Equal(t, `web.requests,fqdn=test.example.com,instance=app value=10 `+ts, lines[2])
+
+	t.Run("label values escaped only for line protocol", func(t *testing.T) {
+		r, err := NewRegistry("", "", 10)
+		require.NoError(t, err)
+		r.MustRegister("disk.free", NewGauge(), map[string]string{"path": `C:\tmp "x",y`}).Update(1)
+		var buf bytes.Buffer
+		require.NoError(t, WriteInfluxDB(&buf, r))
+		assert.True(t, strings.HasPrefix(buf.String(), `disk.free,path=C:\tmp\ "x"\,y value=1 `), buf.String())
+	})
+}
+
+func TestHandleInfluxDB(t *testing.T) {
+	r := influxTestRegistry(t)
+	req, err := http.NewRequest("GET", "/metrics", nil)
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	handleInfluxDB(rr, req, r)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Header().Get("Content-Type"), "text/plain")
+	assert.Contains(t, rr.Body.String(), "web.requests,fqdn=test.example.com,instance=app value=10 ")
+}
+
+func TestInfluxDBExporter(t *testing.T) {
+	r := influxTestRegistry(t)
+	var body string
+	var query string
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		b, _ := io.ReadAll(req.Body)
+		body = string(b)
+		query = req.URL.Path + "?" + req.URL.RawQuery
+		auth = req.Header.Get("Authorization")
+		if req.URL.Query().Get("bucket") != "metrics" {
+			http.Error(w, "bucket not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	e, err := NewInfluxDBExporter(r, InfluxDBConfig{
+		URL:    srv.URL,
+		Org:    "iot",
+		Bucket: "metrics",
+		Token:  "secret",
+	})
+	require.NoError(t, err)
+	require.NoError(t, e.Push(context.Background()))
+	assert.Equal(t, "/api/v2/write?bucket=metrics&org=iot&precision=ns", query)
+	assert.Equal(t, "Token secret", auth)
+	assert.Contains(t, body, "room,fqdn=test.example.com")
+
+	e, err = NewInfluxDBExporter(r, InfluxDBConfig{URL: srv.URL, Bucket: "nonexistent"})
+	require.NoError(t, err)
+	err = e.Push(context.Background())
+	assert.ErrorContains(t, err, "bucket not found")
+
+	_, err = NewInfluxDBExporter(r, InfluxDBConfig{URL: "udp://127.0.0.1"})
+	assert.Error(t, err)
+}
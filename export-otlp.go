@@ -0,0 +1,526 @@
+package mon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type OTLPEncoding int
+
+const (
+	OTLPProtobuf OTLPEncoding = iota
+	OTLPJSON
+)
+
+const otlpScopeName = "github.com/efigence/go-mon"
+
+// OTLP aggregation temporality, we only ever send cumulative
+const otlpTemporalityCumulative = 2
+
+// used as start time of cumulative metrics
+var processStart = time.Now()
+
+// maps common unit names to UCUM. Units not in the list are sent as UCUM annotation, i.e. `{temperature}`
+var otlpUnits = map[string]string{
+	"bytes":        "By",
+	"byte":         "By",
+	"By":           "By",
+	"bits":         "bit",
+	"bit":          "bit",
+	"percent":      "%",
+	"%":            "%",
+	"ns":           "ns",
+	"us":           "us",
+	"ms":           "ms",
+	"milliseconds": "ms",
+	"s":            "s",
+	"seconds":      "s",
+	"celsius":      "Cel",
+	"hz":           "Hz",
+	"Hz":           "Hz",
+}
+
+// OTLPUnit converts unit name to UCUM code
+func OTLPUnit(unit string) string {
+	if unit == "" {
+		return ""
+	}
+	if u, ok := otlpUnits[unit]; ok {
+		return u
+	}
+	return "{" + unit + "}"
+}
+
+// OTLPConfig configures OTLP/HTTP metrics exporter
+type OTLPConfig struct {
+	// Collector URL. If there is no path, /v1/metrics is used, e.g. http://127.0.0.1:4318
+	URL string
+	// Payload encoding, protobuf (default) or JSON
+	Encoding OTLPEncoding
+	// Additional HTTP headers, e.g. for authentication
+	Headers map[string]string
+	// Additional resource attributes; Registry's FQDN and Instance are sent as `host.name` and `service.name`
+	ResourceAttributes map[string]string
+	// HTTP client to use, defaults to client with 10s timeout
+	Client *http.Client
+	PushConfig
+}
+
+// OTLPExporter pushes Registry to OpenTelemetry collector via OTLP/HTTP.
+// Gauges are sent as gauge, counters as cumulative monotonic sum and histograms as cumulative histogram
+type OTLPExporter struct {
+	cfg      OTLPConfig
+	registry *Registry
+	url      string
+}
+
+func NewOTLPExporter(registry *Registry, cfg OTLPConfig) (*OTLPExporter, error) {
+	u, err := parsePushURL("OTLP", cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/v1/metrics"
+	}
+	cfg.setDefaults(registryInterval(registry))
+	cfg.Client = defaultPushClient(cfg.Client)
+	return &OTLPExporter{
+		cfg:      cfg,
+		registry: registry,
+		url:      u.String(),
+	}, nil
+}
+
+// Push sends current state of registry to the collector
+func (e *OTLPExporter) Push(ctx context.Context) error {
+	data := newOTLPRequest(e.registry, e.cfg.ResourceAttributes)
+	var body []byte
+	var contentType string
+	switch e.cfg.Encoding {
+	case OTLPJSON:
+		var err error
+		body, err = json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		contentType = "application/json"
+	default:
+		body = data.proto()
+		contentType = "application/x-protobuf"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range e.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.cfg.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("OTLP export failed with %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// Run pushes metrics right away and then every interval until context is cancelled
+func (e *OTLPExporter) Run(ctx context.Context) error {
+	return e.cfg.run(ctx, e.Push)
+}
+
+// OTLP data model, JSON tags follow OTLP/JSON mapping (64 bit integers as strings)
+
+type otlpRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpMetric struct {
+	Name      string         `json:"name"`
+	Unit      string         `json:"unit,omitempty"`
+	Gauge     *otlpGauge     `json:"gauge,omitempty"`
+	Sum       *otlpSum       `json:"sum,omitempty"`
+	Histogram *otlpHistogram `json:"histogram,omitempty"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpNumberDataPoint `json:"dataPoints"`
+}
+
+type otlpSum struct {
+	DataPoints             []otlpNumberDataPoint `json:"dataPoints"`
+	AggregationTemporality int                   `json:"aggregationTemporality"`
+	IsMonotonic            bool                  `json:"isMonotonic"`
+}
+
+type otlpHistogram struct {
+	DataPoints             []otlpHistogramDataPoint `json:"dataPoints"`
+	AggregationTemporality int                      `json:"aggregationTemporality"`
+}
+
+type otlpNumberDataPoint struct {
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano uint64         `json:"startTimeUnixNano,string,omitempty"`
+	TimeUnixNano      uint64         `json:"timeUnixNano,string"`
+	AsDouble          float64        `json:"asDouble"`
+}
+
+type otlpHistogramDataPoint struct {
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano uint64         `json:"startTimeUnixNano,string"`
+	TimeUnixNano      uint64         `json:"timeUnixNano,string"`
+	Count             uint64         `json:"count,string"`
+	Sum               float64        `json:"sum"`
+	BucketCounts      []otlpUint64   `json:"bucketCounts"`
+	ExplicitBounds    []float64      `json:"explicitBounds"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+// uint64 encoded as JSON string
+type otlpUint64 uint64
+
+func (u otlpUint64) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + strconv.FormatUint(uint64(u), 10) + `"`), nil
+}
+
+func otlpAttributes(attrs map[string]string) []otlpKeyValue {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make([]otlpKeyValue, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, otlpKeyValue{Key: k, Value: otlpAnyValue{StringValue: attrs[k]}})
+	}
+	return out
+}
+
+func newOTLPRequest(registry *Registry, resourceAttributes map[string]string) otlpRequest {
+	snapshot := registry.GetRegistry()
+	ts := uint64(snapshot.Ts.UnixNano())
+	start := uint64(processStart.UnixNano())
+	resource := map[string]string{}
+	if snapshot.FQDN != "" {
+		resource["host.name"] = snapshot.FQDN
+	}
+	if snapshot.Instance != "" {
+		resource["service.name"] = snapshot.Instance
+	}
+	for k, v := range resourceAttributes {
+		resource[k] = v
+	}
+	names := make([]string, 0, len(snapshot.Metrics))
+	for name := range snapshot.Metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var metrics []otlpMetric
+	for _, name := range names {
+		// series with different types under same name are sent as separate metrics
+		byType := map[string]*otlpMetric{}
+		var types []string
+		gobs := make([]string, 0, len(snapshot.Metrics[name]))
+		for gob := range snapshot.Metrics[name] {
+			gobs = append(gobs, gob)
+		}
+		sort.Strings(gobs)
+		for _, gob := range gobs {
+			metric := snapshot.Metrics[name][gob]
+			var attrs []otlpKeyValue
+			if gob != string(emptyGob) {
+				attrs = otlpAttributes(ungobTag([]byte(gob)).T)
+			}
+			m, ok := byType[metric.Type()]
+			if !ok {
+				m = &otlpMetric{Name: name, Unit: OTLPUnit(metric.Unit())}
+				byType[metric.Type()] = m
+				types = append(types, metric.Type())
+			}
+			if h, ok := metric.(Histogram); ok {
+				snap := h.HistogramSnapshot()
+				if m.Histogram == nil {
+					m.Histogram = &otlpHistogram{AggregationTemporality: otlpTemporalityCumulative}
+				}
+				// OTLP bucket counts are per-bucket, with extra one for values above last bound
+				counts := make([]otlpUint64, len(snap.Counts)+1)
+				var prev uint64
+				for i, c := range snap.Counts {
+					counts[i] = otlpUint64(c - prev)
+					prev = c
+				}
+				counts[len(snap.Counts)] = otlpUint64(snap.Count - prev)
+				m.Histogram.DataPoints = append(m.Histogram.DataPoints, otlpHistogramDataPoint{
+					Attributes:        attrs,
+					StartTimeUnixNano: start,
+					TimeUnixNano:      ts,
+					Count:             snap.Count,
+					Sum:               snap.Sum,
+					BucketCounts:      counts,
+					ExplicitBounds:    snap.Buckets,
+				})
+				continue
+			}
+			v := metric.Value()
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				continue
+			}
+			switch metric.Type() {
+			case MetricTypeCounter, MetricTypeCounterFloat:
+				if m.Sum == nil {
+					m.Sum = &otlpSum{AggregationTemporality: otlpTemporalityCumulative, IsMonotonic: true}
+				}
+				m.Sum.DataPoints = append(m.Sum.DataPoints, otlpNumberDataPoint{
+					Attributes:        attrs,
+					StartTimeUnixNano: start,
+					TimeUnixNano:      ts,
+					AsDouble:          v,
+				})
+			default:
+				if m.Gauge == nil {
+					m.Gauge = &otlpGauge{}
+				}
+				m.Gauge.DataPoints = append(m.Gauge.DataPoints, otlpNumberDataPoint{
+					Attributes:   attrs,
+					TimeUnixNano: ts,
+					AsDouble:     v,
+				})
+			}
+		}
+		for _, t := range types {
+			m := byType[t]
+			if m.Gauge == nil && m.Sum == nil && m.Histogram == nil {
+				continue
+			}
+			metrics = append(metrics, *m)
+		}
+	}
+	return otlpRequest{
+		ResourceMetrics: []otlpResourceMetrics{{
+			Resource: otlpResource{Attributes: otlpAttributes(resource)},
+			ScopeMetrics: []otlpScopeMetrics{{
+				Scope:   otlpScope{Name: otlpScopeName},
+				Metrics: metrics,
+			}},
+		}},
+	}
+}
+
+// protobuf encoding of ExportMetricsServiceRequest,
+// field numbers from opentelemetry/proto/metrics/v1/metrics.proto
+
+func (r otlpRequest) proto() []byte {
+	var b protoBuf
+	for _, rm := range r.ResourceMetrics {
+		b.message(1, rm.proto())
+	}
+	return b
+}
+
+func (r otlpResourceMetrics) proto() []byte {
+	var b, res protoBuf
+	for _, a := range r.Resource.Attributes {
+		res.message(1, a.proto())
+	}
+	b.message(1, res)
+	for _, sm := range r.ScopeMetrics {
+		b.message(2, sm.proto())
+	}
+	return b
+}
+
+func (s otlpScopeMetrics) proto() []byte {
+	var b, scope protoBuf
+	scope.string(1, s.Scope.Name)
+	b.message(1, scope)
+	for _, m := range s.Metrics {
+		b.message(2, m.proto())
+	}
+	return b
+}
+
+func (m otlpMetric) proto() []byte {
+	var b protoBuf
+	b.string(1, m.Name)
+	b.string(3, m.Unit)
+	switch {
+	case m.Gauge != nil:
+		var g protoBuf
+		for _, dp := range m.Gauge.DataPoints {
+			g.message(1, dp.proto())
+		}
+		b.message(5, g)
+	case m.Sum != nil:
+		var s protoBuf
+		for _, dp := range m.Sum.DataPoints {
+			s.message(1, dp.proto())
+		}
+		s.varint(2, uint64(m.Sum.AggregationTemporality))
+		s.bool(3, m.Sum.IsMonotonic)
+		b.message(7, s)
+	case m.Histogram != nil:
+		var h protoBuf
+		for _, dp := range m.Histogram.DataPoints {
+			h.message(1, dp.proto())
+		}
+		h.varint(2, uint64(m.Histogram.AggregationTemporality))
+		b.message(9, h)
+	}
+	return b
+}
+
+func (dp otlpNumberDataPoint) proto() []byte {
+	var b protoBuf
+	if dp.StartTimeUnixNano > 0 {
+		b.fixed64(2, dp.StartTimeUnixNano)
+	}
+	b.fixed64(3, dp.TimeUnixNano)
+	b.double(4, dp.AsDouble)
+	for _, a := range dp.Attributes {
+		b.message(7, a.proto())
+	}
+	return b
+}
+
+func (dp otlpHistogramDataPoint) proto() []byte {
+	var b protoBuf
+	b.fixed64(2, dp.StartTimeUnixNano)
+	b.fixed64(3, dp.TimeUnixNano)
+	b.fixed64(4, dp.Count)
+	b.double(5, dp.Sum)
+	counts := make([]uint64, len(dp.BucketCounts))
+	for i, c := range dp.BucketCounts {
+		counts[i] = uint64(c)
+	}
+	b.packedFixed64(6, counts)
+	b.packedDouble(7, dp.ExplicitBounds)
+	for _, a := range dp.Attributes {
+		b.message(9, a.proto())
+	}
+	return b
+}
+
+func (kv otlpKeyValue) proto() []byte {
+	var b, v protoBuf
+	b.string(1, kv.Key)
+	v.string(1, kv.Value.StringValue)
+	b.message(2, v)
+	return b
+}
+
+// minimal protobuf wire format encoder
+type protoBuf []byte
+
+const (
+	protoWireVarint  = 0
+	protoWireFixed64 = 1
+	protoWireBytes   = 2
+)
+
+func (b *protoBuf) rawVarint(v uint64) {
+	for v >= 0x80 {
+		*b = append(*b, byte(v)|0x80)
+		v >>= 7
+	}
+	*b = append(*b, byte(v))
+}
+
+func (b *protoBuf) tag(field int, wire int) {
+	b.rawVarint(uint64(field)<<3 | uint64(wire))
+}
+
+func (b *protoBuf) varint(field int, v uint64) {
+	b.tag(field, protoWireVarint)
+	b.rawVarint(v)
+}
+
+func (b *protoBuf) bool(field int, v bool) {
+	if v {
+		b.varint(field, 1)
+	} else {
+		b.varint(field, 0)
+	}
+}
+
+func (b *protoBuf) rawFixed64(v uint64) {
+	for i := 0; i < 8; i++ {
+		*b = append(*b, byte(v>>(8*i)))
+	}
+}
+
+func (b *protoBuf) fixed64(field int, v uint64) {
+	b.tag(field, protoWireFixed64)
+	b.rawFixed64(v)
+}
+
+func (b *protoBuf) double(field int, v float64) {
+	b.fixed64(field, math.Float64bits(v))
+}
+
+func (b *protoBuf) message(field int, data []byte) {
+	b.tag(field, protoWireBytes)
+	b.rawVarint(uint64(len(data)))
+	*b = append(*b, data...)
+}
+
+func (b *protoBuf) string(field int, s string) {
+	if s == "" {
+		return
+	}
+	b.message(field, []byte(s))
+}
+
+func (b *protoBuf) packedFixed64(field int, vs []uint64) {
+	var p protoBuf
+	for _, v := range vs {
+		p.rawFixed64(v)
+	}
+	b.message(field, p)
+}
+
+func (b *protoBuf) packedDouble(field int, vs []float64) {
+	var p protoBuf
+	for _, v := range vs {
+		p.rawFixed64(math.Float64bits(v))
+	}
+	b.message(field, p)
+}
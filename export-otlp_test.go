@@ -0,0 +1,211 @@
+package mon
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type otlpTestField struct {
+	num   int
+	value uint64
+	data  []byte
+}
+
+// decodes single level of protobuf message
+func otlpTestDecode(t *testing.T, b []byte) (fields []otlpTestField) {
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		require.Greater(t, n, 0)
+		b = b[n:]
+		f := otlpTestField{num: int(key >> 3)}
+		switch key & 7 {
+		case protoWireVarint:
+			f.value, n = binary.Uvarint(b)
+			require.Greater(t, n, 0)
+			b = b[n:]
+		case protoWireFixed64:
+			f.value = binary.LittleEndian.Uint64(b)
+			b = b[8:]
+		case protoWireBytes:
+			l, n := binary.Uvarint(b)
+			require.Greater(t, n, 0)
+			f.data = b[n : n+int(l)]
+			b = b[n+int(l):]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+func otlpTestGet(t *testing.T, b []byte, num int) (out []otlpTestField) {
+	for _, f := range otlpTestDecode(t, b) {
+		if f.num == num {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+func otlpTestRegistry(t *testing.T) *Registry {
+	r, err := NewRegistry("test.example.com", "app", 10)
+	require.NoError(t, err)
+	r.MustRegister("room", NewGauge("temperature"), map[string]string{"floor": "1"}).Update(23.4)
+	r.MustRegister("web.requests", NewCounter()).Update(10)
+	h := r.MustRegister("web.latency", NewHistogram([]float64{1, 10}, "ms"))
+	h.Update(0.5)
+	h.Update(5)
+	h.Update(50)
+	return r
+}
+
+func TestOTLPUnit(t *testing.T) {
+	assert.Equal(t, "By", OTLPUnit("bytes"))
+	assert.Equal(t, "%", OTLPUnit("percent"))
+	assert.Equal(t, "s", OTLPUnit("seconds"))
+	assert.Equal(t, "{temperature}", OTLPUnit("temperature"))
+	assert.Equal(t, "", OTLPUnit(""))
+}
+
+func TestOTLPRawLabels(t *testing.T) {
+	r, err := NewRegistry("", "", 10)
+	require.NoError(t, err)
+	r.MustRegister("disk.free", NewGauge(), map[string]string{"path": `C:\tmp "x"`}).Update(1)
+	js, err := json.Marshal(newOTLPRequest(r, nil))
+	require.NoError(t, err)
+	assert.Contains(t, string(js), `{"key":"path","value":{"stringValue":"C:\\tmp \"x\""}}`, "attribute is not escaped for Prometheus")
+}
+
+func TestOTLPExporterJSON(t *testing.T) {
+	var body map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "/v1/metrics", req.URL.Path)
+		assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+		assert.Equal(t, "secret", req.Header.Get("X-Api-Key"))
+		b, _ := io.ReadAll(req.Body)
+		require.NoError(t, json.Unmarshal(b, &body))
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+	e, err := NewOTLPExporter(otlpTestRegistry(t), OTLPConfig{
+		URL:      srv.URL,
+		Encoding: OTLPJSON,
+		Headers:  map[string]string{"X-Api-Key": "secret"},
+	})
+	require.NoError(t, err)
+	require.NoError(t, e.Push(context.Background()))
+
+	rm := body["resourceMetrics"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t,
+		[]interface{}{
+			map[string]interface{}{"key": "host.name", "value": map[string]interface{}{"stringValue": "test.example.com"}},
+			map[string]interface{}{"key": "service.name", "value": map[string]interface{}{"stringValue": "app"}},
+		},
+		rm["resource"].(map[string]interface{})["attributes"])
+	metrics := rm["scopeMetrics"].([]interface{})[0].(map[string]interface{})["metrics"].([]interface{})
+	require.Len(t, metrics, 3)
+
+	room := metrics[0].(map[string]interface{})
+	assert.Equal(t, "room", room["name"])
+	assert.Equal(t, "{temperature}", room["unit"])
+	roomDp := room["gauge"].(map[string]interface{})["dataPoints"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, 23.4, roomDp["asDouble"])
+	assert.IsType(t, "", roomDp["timeUnixNano"], "64 bit ints are strings in OTLP/JSON")
+
+	latency := metrics[1].(map[string]interface{})
+	assert.Equal(t, "ms", latency["unit"])
+	hist := latency["histogram"].(map[string]interface{})
+	assert.Equal(t, 2.0, hist["aggregationTemporality"])
+	histDp := hist["dataPoints"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "3", histDp["count"])
+	assert.Equal(t, []interface{}{"1", "1", "1"}, histDp["bucketCounts"])
+	assert.Equal(t, []interface{}{1.0, 10.0}, histDp["explicitBounds"])
+
+	requests := metrics[2].(map[string]interface{})
+	sum := requests["sum"].(map[string]interface{})
+	assert.Equal(t, true, sum["isMonotonic"])
+	assert.Equal(t, 2.0, sum["aggregationTemporality"])
+}
+
+func TestOTLPExporterProtobuf(t *testing.T) {
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "application/x-protobuf", req.Header.Get("Content-Type"))
+		body, _ = io.ReadAll(req.Body)
+	}))
+	defer srv.Close()
+	e, err := NewOTLPExporter(otlpTestRegistry(t), OTLPConfig{URL: srv.URL})
+	require.NoError(t, err)
+	require.NoError(t, e.Push(context.Background()))
+
+	rm := otlpTestGet(t, body, 1)
+	require.Len(t, rm, 1)
+	resource := otlpTestGet(t, rm[0].data, 1)[0].data
+	attrs := otlpTestGet(t, resource, 1)
+	require.Len(t, attrs, 2)
+	assert.Equal(t, "host.name", string(otlpTestGet(t, attrs[0].data, 1)[0].data))
+	sm := otlpTestGet(t, rm[0].data, 2)[0].data
+	assert.Equal(t, otlpScopeName, string(otlpTestGet(t, otlpTestGet(t, sm, 1)[0].data, 1)[0].data))
+	metrics := otlpTestGet(t, sm, 2)
+	require.Len(t, metrics, 3)
+
+	room := metrics[0].data
+	assert.Equal(t, "room", string(otlpTestGet(t, room, 1)[0].data))
+	gauge := otlpTestGet(t, room, 5)
+	require.Len(t, gauge, 1)
+	dp := otlpTestGet(t, gauge[0].data, 1)[0].data
+	assert.Equal(t, 23.4, math.Float64frombits(otlpTestGet(t, dp, 4)[0].value))
+	attr := otlpTestGet(t, dp, 7)[0].data
+	assert.Equal(t, "floor", string(otlpTestGet(t, attr, 1)[0].data))
+
+	hist := otlpTestGet(t, metrics[1].data, 9)
+	require.Len(t, hist, 1)
+	hdp := otlpTestGet(t, hist[0].data, 1)[0].data
+	assert.Equal(t, uint64(3), otlpTestGet(t, hdp, 4)[0].value, "count")
+	assert.Len(t, otlpTestGet(t, hdp, 6)[0].data, 3*8, "packed bucket counts")
+
+	sum := otlpTestGet(t, metrics[2].data, 7)
+	require.Len(t, sum, 1)
+	assert.Equal(t, uint64(otlpTemporalityCumulative), otlpTestGet(t, sum[0].data, 2)[0].value)
+	assert.Equal(t, uint64(1), otlpTestGet(t, sum[0].data, 3)[0].value, "monotonic")
+}
+
+func TestOTLPExporterError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "bad data", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+	e, err := NewOTLPExporter(otlpTestRegistry(t), OTLPConfig{URL: srv.URL + "/custom/path"})
+	require.NoError(t, err)
+	assert.ErrorContains(t, e.Push(context.Background()), "bad data")
+
+	errs := make(chan error, 1)
+	e, err = NewOTLPExporter(otlpTestRegistry(t), OTLPConfig{
+		URL:        srv.URL,
+		PushConfig: PushConfig{Interval: time.Hour, OnError: func(err error) { errs <- err }},
+	})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go e.Run(ctx)
+	select {
+	case err := <-errs:
+		assert.ErrorContains(t, err, "bad data", "Run pushes without waiting for interval")
+	case <-time.After(time.Second):
+		t.Fatal("no push after Run")
+	}
+
+	_, err = NewOTLPExporter(otlpTestRegistry(t), OTLPConfig{URL: "grpc://127.0.0.1:4317"})
+	assert.Error(t, err)
+}
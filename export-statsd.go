@@ -0,0 +1,298 @@
+package mon
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StatsdConfig configures StatsD/DogStatsD exporter
+type StatsdConfig struct {
+	// Address of statsd agent. Accepts "udp://host:port", "unixgram:///path/to/socket" or bare "host:port" (UDP)
+	Address string
+	// Prefix prepended to every metric name, e.g. "myapp."
+	Prefix string
+	// Maximum size of single packet, defaults to 1432 for UDP (fits into ethernet MTU) and 8192 for unix sockets
+	MaxPacketSize int
+	// Sample rate for counters and histograms, (0,1]. Defaults to 1 (send everything)
+	SampleRate float64
+	// Tags added to every metric
+	Tags map[string]string
+	// Plain StatsD mode; do not emit DogStatsD tags at all
+	NoTags bool
+	PushConfig
+}
+
+// StatsdExporter pushes metrics from the Registry to StatsD agent.
+//
+// * gauges are sent as `|g`
+// * counters are sent as deltas since previous flush, `|c`
+// * histograms are sent as one value per bucket that got observations since previous flush (bucket's midpoint), with sample rate set so agent counts them correctly; `|ms` if unit is time, `|h` otherwise
+type StatsdExporter struct {
+	cfg      StatsdConfig
+	registry *Registry
+	conn     net.Conn
+	// last seen counter values
+	last map[string]float64
+	// last seen histogram count/sum
+	lastHist map[string]HistogramSnapshot
+	rand     *rand.Rand
+	sync.Mutex
+}
+
+var statsdTagRepl = strings.NewReplacer(
+	"|", "_",
+	",", "_",
+	"#", "_",
+	"\n", "_",
+)
+
+var statsdNameRepl = strings.NewReplacer(
+	"|", "_",
+	":", "_",
+	"@", "_",
+	"\n", "_",
+)
+
+// NewStatsdExporter creates exporter and connects it to the address in config
+func NewStatsdExporter(registry *Registry, cfg StatsdConfig) (*StatsdExporter, error) {
+	network, addr := "udp", cfg.Address
+	if i := strings.Index(cfg.Address, "://"); i >= 0 {
+		network, addr = cfg.Address[:i], cfg.Address[i+3:]
+	}
+	switch network {
+	case "udp", "udp4", "udp6":
+		if cfg.MaxPacketSize <= 0 {
+			cfg.MaxPacketSize = 1432
+		}
+	case "unixgram":
+		if cfg.MaxPacketSize <= 0 {
+			cfg.MaxPacketSize = 8192
+		}
+	default:
+		return nil, fmt.Errorf("unsupported statsd network [%s], use udp or unixgram", network)
+	}
+	if cfg.SampleRate <= 0 || cfg.SampleRate > 1 {
+		cfg.SampleRate = 1
+	}
+	cfg.setDefaults(registryInterval(registry))
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to statsd at %s: %w", cfg.Address, err)
+	}
+	return &StatsdExporter{
+		cfg:      cfg,
+		registry: registry,
+		conn:     conn,
+		last:     make(map[string]float64),
+		lastHist: make(map[string]HistogramSnapshot),
+		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}, nil
+}
+
+// Flush sends current state of registry to statsd
+func (e *StatsdExporter) Flush() error {
+	e.Lock()
+	defer e.Unlock()
+	var lines []string
+	for name, series := range e.registry.GetRegistry().Metrics {
+		for gob, metric := range series {
+			lines = append(lines, e.lines(name, gob, metric)...)
+		}
+	}
+	return e.send(lines)
+}
+
+// Run flushes metrics right away and then every interval until context is cancelled, then flushes them one last time
+func (e *StatsdExporter) Run(ctx context.Context) error {
+	err := e.cfg.run(ctx, func(ctx context.Context) error {
+		return e.Flush()
+	})
+	if flushErr := e.Flush(); flushErr != nil && e.cfg.OnError != nil {
+		e.cfg.OnError(flushErr)
+	}
+	return err
+}
+
+func (e *StatsdExporter) Close() error {
+	return e.conn.Close()
+}
+
+func (e *StatsdExporter) lines(name string, gob string, metric Metric) (out []string) {
+	key := name + "\x00" + gob
+	metricName := statsdNameRepl.Replace(e.cfg.Prefix + name)
+	tags := e.tags(gob)
+	switch metric.Type() {
+	case MetricTypeCounter, MetricTypeCounterFloat:
+		v := metric.Value()
+		delta := v
+		if last, ok := e.last[key]; ok && v >= last {
+			delta = v - last
+		}
+		e.last[key] = v
+		if delta == 0 || !e.sampled() {
+			return nil
+		}
+		return []string{metricName + ":" + statsdFloat(delta) + "|c" + e.rate(e.cfg.SampleRate) + tags}
+	case MetricTypeHistogram:
+		h, ok := metric.(Histogram)
+		if !ok {
+			break
+		}
+		snap := h.HistogramSnapshot()
+		last := e.lastHist[key]
+		e.lastHist[key] = snap
+		if snap.Count < last.Count {
+			last = HistogramSnapshot{}
+		}
+		count := snap.Count - last.Count
+		if count == 0 || !e.sampled() {
+			return nil
+		}
+		mult, isTime := statsdTimeUnits[metric.Unit()]
+		kind := "|ms"
+		if !isTime {
+			mult, kind = 1, "|h"
+		}
+		for _, b := range statsdHistogramBuckets(snap, last) {
+			out = append(out, metricName+":"+statsdFloat(b.value*mult)+kind+e.rate(e.cfg.SampleRate/float64(b.count))+tags)
+		}
+		return out
+	}
+	v := metric.Value()
+	// leading sign means relative change in statsd gauges so negative gauge have to be reset to 0 first
+	if v < 0 {
+		out = append(out, metricName+":0|g"+tags)
+	}
+	return append(out, metricName+":"+statsdFloat(v)+"|g"+tags)
+}
+
+type statsdBucket struct {
+	value float64
+	count uint64
+}
+
+// statsdHistogramBuckets returns representative value and count of observations for each histogram bucket that got new observations.
+// Bucket is represented by its midpoint (half of upper bound for the first one), observations above the last bucket
+// by their mean derived from the sum. If all observations fell into one bucket, their exact mean is used
+func statsdHistogramBuckets(snap HistogramSnapshot, last HistogramSnapshot) (out []statsdBucket) {
+	count := snap.Count - last.Count
+	sum := snap.Sum - last.Sum
+	var prevCumulative uint64
+	for i, upper := range snap.Buckets {
+		var cumulative uint64
+		if i < len(snap.Counts) {
+			cumulative = snap.Counts[i]
+		}
+		if i < len(last.Counts) {
+			cumulative -= last.Counts[i]
+		}
+		c := cumulative - prevCumulative
+		prevCumulative = cumulative
+		if c == 0 {
+			continue
+		}
+		if c == count {
+			return []statsdBucket{{value: sum / float64(count), count: c}}
+		}
+		v := upper / 2
+		if i > 0 {
+			v = (snap.Buckets[i-1] + upper) / 2
+		}
+		out = append(out, statsdBucket{value: v, count: c})
+		sum -= v * float64(c)
+	}
+	if c := count - prevCumulative; c > 0 {
+		if c == count {
+			return []statsdBucket{{value: sum / float64(count), count: c}}
+		}
+		v := sum / float64(c)
+		if len(snap.Buckets) > 0 && v < snap.Buckets[len(snap.Buckets)-1] {
+			v = snap.Buckets[len(snap.Buckets)-1]
+		}
+		out = append(out, statsdBucket{value: v, count: c})
+	}
+	return out
+}
+
+// multipliers to convert time unit to milliseconds
+var statsdTimeUnits = map[string]float64{
+	"ns":           1e-6,
+	"us":           1e-3,
+	"ms":           1,
+	"s":            1e3,
+	"seconds":      1e3,
+	"milliseconds": 1,
+}
+
+func (e *StatsdExporter) tags(gob string) string {
+	if e.cfg.NoTags {
+		return ""
+	}
+	tags := map[string]string{}
+	for k, v := range e.cfg.Tags {
+		tags[k] = v
+	}
+	if gob != string(emptyGob) {
+		for k, v := range ungobTag([]byte(gob)).T {
+			tags[k] = v
+		}
+	}
+	if len(tags) == 0 {
+		return ""
+	}
+	tagSlice := make([]string, 0, len(tags))
+	for k, v := range tags {
+		tagSlice = append(tagSlice, statsdTagRepl.Replace(k)+":"+statsdTagRepl.Replace(v))
+	}
+	sort.Strings(tagSlice)
+	return "|#" + strings.Join(tagSlice, ",")
+}
+
+func (e *StatsdExporter) sampled() bool {
+	return e.cfg.SampleRate >= 1 || e.rand.Float64() < e.cfg.SampleRate
+}
+
+func (e *StatsdExporter) rate(r float64) string {
+	if r >= 1 {
+		return ""
+	}
+	return "|@" + strconv.FormatFloat(r, 'g', 6, 64)
+}
+
+// send lines batching them into packets up to MaxPacketSize
+func (e *StatsdExporter) send(lines []string) error {
+	var buf bytes.Buffer
+	var firstErr error
+	flush := func() {
+		if buf.Len() == 0 {
+			return
+		}
+		if _, err := e.conn.Write(buf.Bytes()); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		buf.Reset()
+	}
+	for _, l := range lines {
+		if buf.Len() > 0 && buf.Len()+1+len(l) > e.cfg.MaxPacketSize {
+			flush()
+		}
+		if buf.Len() > 0 {
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(l)
+	}
+	flush()
+	return firstErr
+}
+
+func statsdFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
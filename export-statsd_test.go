@@ -0,0 +1,177 @@
+package mon
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func statsdTestListener(t *testing.T) (net.PacketConn, func() []string) {
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	return l, func() (packets []string) {
+		buf := make([]byte, 65536)
+		for {
+			l.SetReadDeadline(time.Now().Add(time.Millisecond * 100))
+			n, _, err := l.ReadFrom(buf)
+			if err != nil {
+				return packets
+			}
+			packets = append(packets, string(buf[:n]))
+		}
+	}
+}
+
+func TestStatsdExporter(t *testing.T) {
+	l, read := statsdTestListener(t)
+	r, err := NewRegistry("test.example.com", "app", 10)
+	require.NoError(t, err)
+	gauge := r.MustRegister("room", NewGauge("temperature"), map[string]string{"floor": "1"})
+	counter := r.MustRegister("web.requests", NewCounter())
+	negative := r.MustRegister("balance", NewGauge())
+	hist := r.MustRegister("web.latency", NewHistogram([]float64{1, 10, 100}, "ms"))
+	gauge.Update(23.4)
+	counter.Update(10)
+	negative.Update(-5)
+	hist.Update(2)
+	hist.Update(4)
+
+	e, err := NewStatsdExporter(r, StatsdConfig{
+		Address: "udp://" + l.LocalAddr().String(),
+		Prefix:  "p.",
+		Tags:    map[string]string{"env": "test"},
+	})
+	require.NoError(t, err)
+	defer e.Close()
+	require.NoError(t, e.Flush())
+	out := strings.Join(read(), "\n")
+	assert.Contains(t, out, "p.room:23.4|g|#env:test,floor:1")
+	assert.Contains(t, out, "p.web.requests:10|c|#env:test")
+	assert.Contains(t, out, "p.balance:0|g|#env:test\np.balance:-5|g|#env:test")
+	assert.Contains(t, out, "p.web.latency:3|ms|@0.5|#env:test")
+
+	t.Run("counters as deltas", func(t *testing.T) {
+		counter.Update(5)
+		require.NoError(t, e.Flush())
+		out := strings.Join(read(), "\n")
+		assert.Contains(t, out, "p.web.requests:5|c|#env:test")
+		assert.NotContains(t, out, "p.web.latency", "no new observations")
+	})
+	t.Run("histogram buckets", func(t *testing.T) {
+		hist.Update(0.5)
+		hist.Update(20)
+		hist.Update(40)
+		hist.Update(1000)
+		require.NoError(t, e.Flush())
+		out := strings.Join(read(), "\n")
+		assert.Contains(t, out, "p.web.latency:0.5|ms|#env:test")
+		assert.Contains(t, out, "p.web.latency:55|ms|@0.5|#env:test")
+		assert.Contains(t, out, "p.web.latency:950|ms|#env:test", "overflow gets rest of the sum")
+	})
+}
+
+func TestStatsdHistogramBuckets(t *testing.T) {
+	h := NewHistogram([]float64{1, 10, 100}).(*MetricHistogram)
+	for _, v := range []float64{5, 7} {
+		h.Update(v)
+	}
+	first := h.HistogramSnapshot()
+	assert.Equal(t, []statsdBucket{{value: 6, count: 2}}, statsdHistogramBuckets(first, HistogramSnapshot{}), "single bucket sent as exact mean")
+	for _, v := range []float64{0.5, 2, 4, 500} {
+		h.Update(v)
+	}
+	assert.Equal(t, []statsdBucket{
+		{value: 0.5, count: 1},
+		{value: 5.5, count: 2},
+		{value: 495, count: 1},
+	}, statsdHistogramBuckets(h.HistogramSnapshot(), first))
+	h = NewHistogram([]float64{1, 10, 100}).(*MetricHistogram)
+	h.Update(50)
+	h.Update(101)
+	assert.Equal(t, []statsdBucket{
+		{value: 55, count: 1},
+		{value: 100, count: 1},
+	}, statsdHistogramBuckets(h.HistogramSnapshot(), HistogramSnapshot{}), "overflow is never below last bucket")
+}
+
+func TestStatsdExporterRawLabels(t *testing.T) {
+	e := &StatsdExporter{}
+	gob := string(gobTag(mapToGobTag(map[string]string{"path": `C:\tmp "x",y`})))
+	assert.Equal(t, `|#path:C:\tmp "x"_y`, e.tags(gob))
+}
+
+func TestStatsdExporterBatching(t *testing.T) {
+	l, read := statsdTestListener(t)
+	r, err := NewRegistry("", "", 10)
+	require.NoError(t, err)
+	for i := 0; i < 50; i++ {
+		r.MustRegister("gauge.number", NewGauge(), map[string]string{"n": strings.Repeat("x", i)}).Update(1)
+	}
+	e, err := NewStatsdExporter(r, StatsdConfig{
+		Address:       l.LocalAddr().String(),
+		MaxPacketSize: 256,
+		NoTags:        true,
+	})
+	require.NoError(t, err)
+	defer e.Close()
+	require.NoError(t, e.Flush())
+	packets := read()
+	assert.Greater(t, len(packets), 1)
+	lines := 0
+	for _, p := range packets {
+		assert.LessOrEqual(t, len(p), 256)
+		lines += len(strings.Split(p, "\n"))
+		assert.NotContains(t, p, "|#")
+	}
+	assert.Equal(t, 50, lines)
+}
+
+func TestStatsdExporterRun(t *testing.T) {
+	l, read := statsdTestListener(t)
+	r, err := NewRegistry("", "", 5)
+	require.NoError(t, err)
+	r.MustRegister("room", NewGauge()).Update(23)
+	e, err := NewStatsdExporter(r, StatsdConfig{Address: l.LocalAddr().String()})
+	require.NoError(t, err)
+	defer e.Close()
+	assert.Equal(t, time.Second*5, e.cfg.Interval, "defaults to registry's interval")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go e.Run(ctx)
+	assert.Contains(t, strings.Join(read(), "\n"), "room:23|g", "flushed without waiting for interval")
+
+	t.Run("errors", func(t *testing.T) {
+		socket := filepath.Join(t.TempDir(), "statsd.sock")
+		agent, err := net.ListenPacket("unixgram", socket)
+		require.NoError(t, err)
+		errs := make(chan error, 2)
+		e, err := NewStatsdExporter(r, StatsdConfig{
+			Address:    "unixgram://" + socket,
+			PushConfig: PushConfig{OnError: func(err error) { errs <- err }},
+		})
+		require.NoError(t, err)
+		defer e.Close()
+		agent.Close()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go e.Run(ctx)
+		select {
+		case err := <-errs:
+			assert.Error(t, err)
+		case <-time.After(time.Second):
+			t.Fatal("flush error not reported")
+		}
+	})
+}
+
+func TestStatsdExporterBadAddress(t *testing.T) {
+	_, err := NewStatsdExporter(GlobalRegistry, StatsdConfig{Address: "tcp://127.0.0.1:1"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,310 @@
+package mon
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var zabbixHeader = []byte("ZBXD\x01")
+
+// max response size we are willing to read from the server
+const zabbixMaxResponse = 1 << 20
+
+// ZabbixConfig configures Zabbix sender (trapper items) exporter
+type ZabbixConfig struct {
+	// Zabbix server or proxy address, port defaults to 10051
+	Address string
+	// Host name as configured in Zabbix, defaults to Registry's FQDN
+	Host string
+	// KeyPrefix is prepended to every item key, e.g. "myapp."
+	KeyPrefix string
+	// KeyFunc maps metric name and labels to item key (without prefix).
+	// Default is `name` for series without labels and `name[value1,value2]` with values ordered by label name
+	KeyFunc func(name string, labels map[string]string) string
+	// Status to send as `status`/`status.msg` items (and `status[component]` for each component). Optional
+	Status *Status
+	// Connection and I/O timeout, defaults to 10s
+	Timeout time.Duration
+	PushConfig
+}
+
+// ZabbixExporter pushes registry values (and optionally Status) to Zabbix trapper items via Zabbix sender protocol
+type ZabbixExporter struct {
+	cfg      ZabbixConfig
+	registry *Registry
+}
+
+// ZabbixItem is single value sent to Zabbix
+type ZabbixItem struct {
+	Host  string `json:"host"`
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	Clock int64  `json:"clock,omitempty"`
+	NS    int64  `json:"ns,omitempty"`
+}
+
+// ZabbixResponse is server's reply to sender request
+type ZabbixResponse struct {
+	Response string `json:"response"`
+	Info     string `json:"info"`
+}
+
+var zabbixInfoRe = regexp.MustCompile(`processed: (\d+); failed: (\d+)`)
+
+// Processed returns number of processed and failed items parsed from server's info message
+func (r ZabbixResponse) Processed() (processed int, failed int) {
+	m := zabbixInfoRe.FindStringSubmatch(r.Info)
+	if m == nil {
+		return 0, 0
+	}
+	processed, _ = strconv.Atoi(m[1])
+	failed, _ = strconv.Atoi(m[2])
+	return processed, failed
+}
+
+func NewZabbixExporter(registry *Registry, cfg ZabbixConfig) (*ZabbixExporter, error) {
+	if cfg.Address == "" {
+		return nil, fmt.Errorf("zabbix server address is required")
+	}
+	if _, _, err := net.SplitHostPort(cfg.Address); err != nil {
+		cfg.Address = net.JoinHostPort(cfg.Address, "10051")
+	}
+	if cfg.Host == "" {
+		cfg.Host = registry.FQDN
+	}
+	if cfg.KeyFunc == nil {
+		cfg.KeyFunc = ZabbixKey
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = time.Second * 10
+	}
+	cfg.setDefaults(registryInterval(registry))
+	return &ZabbixExporter{
+		cfg:      cfg,
+		registry: registry,
+	}, nil
+}
+
+// ZabbixKey is default metric to item key mapping, `name` or `name[value1,value2]` with values ordered by label name
+func ZabbixKey(name string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return name
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	params := make([]string, len(keys))
+	for i, k := range keys {
+		params[i] = zabbixKeyParam(labels[k])
+	}
+	return name + "[" + strings.Join(params, ",") + "]"
+}
+
+// quote key parameter if needed
+func zabbixKeyParam(p string) string {
+	if !strings.ContainsAny(p, `,]["' `) {
+		return p
+	}
+	return `"` + strings.ReplaceAll(p, `"`, `\"`) + `"`
+}
+
+// Items returns current registry values (and status if configured) as zabbix items
+func (e *ZabbixExporter) Items() []ZabbixItem {
+	snapshot := e.registry.GetRegistry()
+	clock, ns := snapshot.Ts.Unix(), int64(snapshot.Ts.Nanosecond())
+	var items []ZabbixItem
+	for name, series := range snapshot.Metrics {
+		for gob, metric := range series {
+			labels := map[string]string{}
+			if gob != string(emptyGob) {
+				labels = ungobTag([]byte(gob)).T
+			}
+			items = append(items, ZabbixItem{
+				Host:  e.cfg.Host,
+				Key:   e.cfg.KeyPrefix + e.cfg.KeyFunc(name, labels),
+				Value: strconv.FormatFloat(metric.Value(), 'f', -1, 64),
+				Clock: clock,
+				NS:    ns,
+			})
+		}
+	}
+	if e.cfg.Status != nil {
+		walkStatus(e.cfg.Status, nil, func(path []string, s *Status) {
+			key := e.cfg.KeyPrefix + "status"
+			msgKey := e.cfg.KeyPrefix + "status.msg"
+			if len(path) > 0 {
+				param := "[" + zabbixKeyParam(strings.Join(path, "/")) + "]"
+				key += param
+				msgKey += param
+			}
+			items = append(items,
+				ZabbixItem{Host: e.cfg.Host, Key: key, Value: strconv.Itoa(s.GetState().NagiosCode()), Clock: clock, NS: ns},
+				ZabbixItem{Host: e.cfg.Host, Key: msgKey, Value: s.GetMessage(), Clock: clock, NS: ns},
+			)
+		})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Key < items[j].Key })
+	return items
+}
+
+// DiscoveryItems returns low-level discovery items:
+// `<name>.discovery` for every labelled metric, with label names as `{#LABEL}` macros
+// and `status.discovery` with `{#COMPONENT}` macro for every status component
+func (e *ZabbixExporter) DiscoveryItems() ([]ZabbixItem, error) {
+	snapshot := e.registry.GetRegistry()
+	var items []ZabbixItem
+	for name, series := range snapshot.Metrics {
+		var data []map[string]string
+		for gob := range series {
+			if gob == string(emptyGob) {
+				continue
+			}
+			entry := map[string]string{}
+			for k, v := range ungobTag([]byte(gob)).T {
+				entry[zabbixMacro(k)] = v
+			}
+			data = append(data, entry)
+		}
+		if len(data) == 0 {
+			continue
+		}
+		sort.Slice(data, func(i, j int) bool { return fmt.Sprint(data[i]) < fmt.Sprint(data[j]) })
+		js, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, ZabbixItem{Host: e.cfg.Host, Key: e.cfg.KeyPrefix + name + ".discovery", Value: string(js)})
+	}
+	if e.cfg.Status != nil {
+		data := []map[string]string{}
+		walkStatus(e.cfg.Status, nil, func(path []string, s *Status) {
+			if len(path) > 0 {
+				data = append(data, map[string]string{"{#COMPONENT}": strings.Join(path, "/")})
+			}
+		})
+		js, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, ZabbixItem{Host: e.cfg.Host, Key: e.cfg.KeyPrefix + "status.discovery", Value: string(js)})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Key < items[j].Key })
+	return items, nil
+}
+
+var zabbixMacroRe = regexp.MustCompile(`[^A-Z0-9_]`)
+
+func zabbixMacro(label string) string {
+	return "{#" + zabbixMacroRe.ReplaceAllString(strings.ToUpper(label), "_") + "}"
+}
+
+// Push sends current values to zabbix. Error is returned if server rejected any of items
+func (e *ZabbixExporter) Push(ctx context.Context) error {
+	return e.sendChecked(ctx, e.Items())
+}
+
+// PushDiscovery sends low-level discovery data. It should be sent before values of newly discovered items
+func (e *ZabbixExporter) PushDiscovery(ctx context.Context) error {
+	items, err := e.DiscoveryItems()
+	if err != nil {
+		return err
+	}
+	return e.sendChecked(ctx, items)
+}
+
+// Run sends discovery data and then values right away and then every interval until context is cancelled.
+// Values are sent even if discovery failed (e.g. server has no LLD rule for it), errors of both are passed to OnError
+func (e *ZabbixExporter) Run(ctx context.Context) error {
+	return e.cfg.run(ctx, func(ctx context.Context) error {
+		discoveryErr := e.PushDiscovery(ctx)
+		if discoveryErr != nil {
+			discoveryErr = fmt.Errorf("discovery: %w", discoveryErr)
+		}
+		return errors.Join(discoveryErr, e.Push(ctx))
+	})
+}
+
+func (e *ZabbixExporter) sendChecked(ctx context.Context, items []ZabbixItem) error {
+	resp, err := e.Send(ctx, items)
+	if err != nil {
+		return err
+	}
+	if resp.Response != "success" {
+		return fmt.Errorf("zabbix server returned [%s]: %s", resp.Response, resp.Info)
+	}
+	if _, failed := resp.Processed(); failed > 0 {
+		return fmt.Errorf("zabbix server rejected %d items: %s", failed, resp.Info)
+	}
+	return nil
+}
+
+// Send sends items to zabbix server and returns its response
+func (e *ZabbixExporter) Send(ctx context.Context, items []ZabbixItem) (resp ZabbixResponse, err error) {
+	payload, err := json.Marshal(struct {
+		Request string       `json:"request"`
+		Data    []ZabbixItem `json:"data"`
+	}{
+		Request: "sender data",
+		Data:    items,
+	})
+	if err != nil {
+		return resp, err
+	}
+	d := net.Dialer{Timeout: e.cfg.Timeout}
+	conn, err := d.DialContext(ctx, "tcp", e.cfg.Address)
+	if err != nil {
+		return resp, fmt.Errorf("error connecting to zabbix at %s: %w", e.cfg.Address, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(e.cfg.Timeout))
+	if _, err := conn.Write(zabbixPacket(payload)); err != nil {
+		return resp, fmt.Errorf("error sending data to zabbix: %w", err)
+	}
+	data, err := readZabbixPacket(conn)
+	if err != nil {
+		return resp, err
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return resp, fmt.Errorf("error decoding zabbix response [%s]: %w", string(data), err)
+	}
+	return resp, nil
+}
+
+// zabbixPacket wraps data in ZBXD header: magic, flags, 4 byte data length and 4 reserved bytes, little endian
+func zabbixPacket(data []byte) []byte {
+	packet := make([]byte, len(zabbixHeader)+8, len(zabbixHeader)+8+len(data))
+	copy(packet, zabbixHeader)
+	binary.LittleEndian.PutUint32(packet[len(zabbixHeader):], uint32(len(data)))
+	return append(packet, data...)
+}
+
+func readZabbixPacket(r io.Reader) ([]byte, error) {
+	header := make([]byte, len(zabbixHeader)+8)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("error reading zabbix header: %w", err)
+	}
+	if string(header[:4]) != "ZBXD" {
+		return nil, fmt.Errorf("bad zabbix header %q", header[:4])
+	}
+	length := binary.LittleEndian.Uint32(header[len(zabbixHeader):])
+	if length > zabbixMaxResponse {
+		return nil, fmt.Errorf("zabbix packet too big: %d", length)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("error reading zabbix data: %w", err)
+	}
+	return data, nil
+}
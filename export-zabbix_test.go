@@ -0,0 +1,183 @@
+package mon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type zabbixTestRequest struct {
+	Request string       `json:"request"`
+	Data    []ZabbixItem `json:"data"`
+}
+
+// fake zabbix server, accepts everything except keys in reject
+func zabbixTestServer(t *testing.T, reject map[string]bool) (addr string, requests chan zabbixTestRequest) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	requests = make(chan zabbixTestRequest, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			data, err := readZabbixPacket(conn)
+			if err != nil {
+				conn.Close()
+				continue
+			}
+			var req zabbixTestRequest
+			json.Unmarshal(data, &req)
+			requests <- req
+			failed := 0
+			for _, i := range req.Data {
+				if reject[i.Key] {
+					failed++
+				}
+			}
+			resp, _ := json.Marshal(ZabbixResponse{
+				Response: "success",
+				Info:     fmt.Sprintf("processed: %d; failed: %d; total: %d; seconds spent: 0.000055", len(req.Data)-failed, failed, len(req.Data)),
+			})
+			conn.Write(zabbixPacket(resp))
+			conn.Close()
+		}
+	}()
+	return l.Addr().String(), requests
+}
+
+func TestZabbixKey(t *testing.T) {
+	assert.Equal(t, "web.requests", ZabbixKey("web.requests", nil))
+	assert.Equal(t, `disk.free[sda,/var/lib]`, ZabbixKey("disk.free", map[string]string{"mount": "/var/lib", "dev": "sda"}))
+	assert.Equal(t, `room["server room"]`, ZabbixKey("room", map[string]string{"location": "server room"}))
+	assert.Equal(t, `room["a,\"b\""]`, ZabbixKey("room", map[string]string{"location": `a,"b"`}))
+}
+
+func TestZabbixExporter(t *testing.T) {
+	addr, requests := zabbixTestServer(t, map[string]bool{"app.bad": true})
+	r, err := NewRegistry("test.example.com", "app", 10)
+	require.NoError(t, err)
+	r.MustRegister("web.requests", NewCounter()).Update(10)
+	r.MustRegister("disk.free", NewGauge("bytes"), map[string]string{"dev": "sda"}).Update(1000)
+	r.MustRegister("disk.free", NewGauge("bytes"), map[string]string{"dev": "sdb"}).Update(2000)
+	s := NewStatus("app")
+	db := s.MustNewComponent("db")
+	require.NoError(t, db.Update(StateCritical, "connection refused"))
+
+	e, err := NewZabbixExporter(r, ZabbixConfig{
+		Address:   addr,
+		KeyPrefix: "app.",
+		Status:    s,
+	})
+	require.NoError(t, err)
+	require.NoError(t, e.Push(context.Background()))
+	req := <-requests
+	assert.Equal(t, "sender data", req.Request)
+	values := map[string]string{}
+	for _, i := range req.Data {
+		assert.Equal(t, "test.example.com", i.Host, "host defaults to registry FQDN")
+		assert.NotZero(t, i.Clock)
+		values[i.Key] = i.Value
+	}
+	assert.Equal(t, map[string]string{
+		"app.web.requests":   "10",
+		"app.disk.free[sda]": "1000",
+		"app.disk.free[sdb]": "2000",
+		"app.status":         "2",
+		"app.status.msg":     "C:[db]connection refused",
+		"app.status[db]":     "2",
+		"app.status.msg[db]": "connection refused",
+	}, values)
+
+	t.Run("discovery", func(t *testing.T) {
+		require.NoError(t, e.PushDiscovery(context.Background()))
+		req := <-requests
+		require.Len(t, req.Data, 2)
+		assert.Equal(t, "app.disk.free.discovery", req.Data[0].Key)
+		assert.JSONEq(t, `[{"{#DEV}":"sda"},{"{#DEV}":"sdb"}]`, req.Data[0].Value)
+		assert.Equal(t, "app.status.discovery", req.Data[1].Key)
+		assert.JSONEq(t, `[{"{#COMPONENT}":"db"}]`, req.Data[1].Value)
+	})
+	t.Run("rejected items", func(t *testing.T) {
+		r.MustRegister("bad", NewGauge())
+		err := e.Push(context.Background())
+		assert.ErrorContains(t, err, "rejected 1 items")
+		<-requests
+	})
+	t.Run("run", func(t *testing.T) {
+		e, err := NewZabbixExporter(r, ZabbixConfig{
+			Address:    addr,
+			PushConfig: PushConfig{Interval: time.Hour},
+		})
+		require.NoError(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go e.Run(ctx)
+		for _, what := range []string{"discovery", "values"} {
+			select {
+			case req := <-requests:
+				assert.NotEmpty(t, req.Data, what)
+			case <-time.After(time.Second):
+				t.Fatalf("no %s sent without waiting for interval", what)
+			}
+		}
+	})
+	t.Run("run without LLD rule", func(t *testing.T) {
+		addr, requests := zabbixTestServer(t, map[string]bool{"disk.free.discovery": true})
+		errs := make(chan error, 1)
+		e, err := NewZabbixExporter(r, ZabbixConfig{
+			Address:    addr,
+			PushConfig: PushConfig{Interval: time.Hour, OnError: func(err error) { errs <- err }},
+		})
+		require.NoError(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go e.Run(ctx)
+		<-requests
+		select {
+		case req := <-requests:
+			keys := []string{}
+			for _, i := range req.Data {
+				keys = append(keys, i.Key)
+			}
+			assert.Contains(t, keys, "web.requests", "values sent even if discovery was rejected")
+		case <-time.After(time.Second):
+			t.Fatal("values not sent after failed discovery")
+		}
+		select {
+		case err := <-errs:
+			assert.ErrorContains(t, err, "discovery: ")
+			assert.ErrorContains(t, err, "rejected 1 items")
+		case <-time.After(time.Second):
+			t.Fatal("discovery error not reported")
+		}
+	})
+}
+
+func TestZabbixRawLabels(t *testing.T) {
+	r, err := NewRegistry("test.example.com", "app", 10)
+	require.NoError(t, err)
+	r.MustRegister("disk.free", NewGauge(), map[string]string{"path": `C:\tmp "x"`}).Update(1)
+	e, err := NewZabbixExporter(r, ZabbixConfig{Address: "127.0.0.1"})
+	require.NoError(t, err)
+	items := e.Items()
+	require.Len(t, items, 1)
+	assert.Equal(t, `disk.free["C:\tmp \"x\""]`, items[0].Key)
+	discovery, err := e.DiscoveryItems()
+	require.NoError(t, err)
+	require.Len(t, discovery, 1)
+	assert.JSONEq(t, `[{"{#PATH}":"C:\\tmp \"x\""}]`, discovery[0].Value)
+}
+
+func TestZabbixPacket(t *testing.T) {
+	p := zabbixPacket([]byte(`{}`))
+	assert.Equal(t, []byte("ZBXD\x01\x02\x00\x00\x00\x00\x00\x00\x00{}"), p)
+}
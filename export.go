@@ -0,0 +1,68 @@
+package mon
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// PushConfig is configuration shared by exporters that push periodically when running via Run()
+type PushConfig struct {
+	// Interval between pushes. Defaults to Registry's interval for metric exporters and to 1 minute for Icinga2Reporter
+	Interval time.Duration
+	// Called with push errors
+	OnError func(error)
+}
+
+// setDefaults sets interval to def if it is not set, falling back to 10s if def is not set either
+func (c *PushConfig) setDefaults(def time.Duration) {
+	if c.Interval <= 0 {
+		c.Interval = def
+	}
+	if c.Interval <= 0 {
+		c.Interval = time.Second * 10
+	}
+}
+
+// run pushes right away and then every interval until context is cancelled
+func (c *PushConfig) run(ctx context.Context, push func(ctx context.Context) error) error {
+	t := time.NewTicker(c.Interval)
+	defer t.Stop()
+	for {
+		if err := push(ctx); err != nil && ctx.Err() == nil && c.OnError != nil {
+			c.OnError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// registryInterval returns registry's update interval as duration
+func registryInterval(registry *Registry) time.Duration {
+	return time.Duration(registry.Interval * float64(time.Second))
+}
+
+// parsePushURL parses URL of service to push to, which has to be http or https
+func parsePushURL(service string, rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s url [%s]: %w", service, rawURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("%s url [%s] needs to be http or https", service, rawURL)
+	}
+	return u, nil
+}
+
+// defaultPushClient returns c or, if it is nil, client with 10s timeout
+func defaultPushClient(c *http.Client) *http.Client {
+	if c == nil {
+		return &http.Client{Timeout: time.Second * 10}
+	}
+	return c
+}
@@ -0,0 +1,82 @@
+package mon
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPushConfigRun(t *testing.T) {
+	var lock sync.Mutex
+	var pushes int
+	var errs []error
+	cfg := PushConfig{
+		Interval: time.Millisecond * 20,
+		OnError: func(err error) {
+			lock.Lock()
+			defer lock.Unlock()
+			errs = append(errs, err)
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- cfg.run(ctx, func(ctx context.Context) error {
+			lock.Lock()
+			defer lock.Unlock()
+			pushes++
+			return errors.New("push failed")
+		})
+	}()
+	assert.Eventually(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return pushes >= 2
+	}, time.Second, time.Millisecond)
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+	assert.NotEmpty(t, errs, "push errors passed to OnError")
+
+	t.Run("first push without waiting for interval", func(t *testing.T) {
+		cfg := PushConfig{Interval: time.Hour}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		pushed := make(chan struct{})
+		go cfg.run(ctx, func(ctx context.Context) error {
+			close(pushed)
+			return nil
+		})
+		select {
+		case <-pushed:
+		case <-time.After(time.Second):
+			t.Fatal("no push before first tick")
+		}
+	})
+}
+
+func TestPushConfigDefaults(t *testing.T) {
+	cfg := PushConfig{}
+	cfg.setDefaults(time.Minute)
+	assert.Equal(t, time.Minute, cfg.Interval)
+	cfg = PushConfig{}
+	cfg.setDefaults(0)
+	assert.Equal(t, time.Second*10, cfg.Interval)
+	cfg = PushConfig{Interval: time.Second}
+	cfg.setDefaults(time.Minute)
+	assert.Equal(t, time.Second, cfg.Interval)
+}
+
+func TestParsePushURL(t *testing.T) {
+	u, err := parsePushURL("InfluxDB", "https://127.0.0.1:8086/base")
+	require.NoError(t, err)
+	assert.Equal(t, "/base", u.Path)
+	_, err = parsePushURL("InfluxDB", "udp://127.0.0.1")
+	assert.EqualError(t, err, "InfluxDB url [udp://127.0.0.1] needs to be http or https")
+	_, err = parsePushURL("InfluxDB", "http://[::1")
+	assert.ErrorContains(t, err, "error parsing InfluxDB url")
+}
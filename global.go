@@ -18,7 +18,9 @@ var GlobalRegistry *Registry
 //      if err != nil { ... } // err generally happens when trying to make same component twice
 //      dbState.Update(mon.Ok,"db running")
 //
-//  note that staleness detection is not handled by the package so any test should be ran in gorouting and with timeouts
+//  staleness detection is off by default, enable it per component with SetTTL():
+//
+//      dbState.SetTTL(time.Minute) // flips to Unknown if not updated for a minute
 
 var GlobalStatus *Status
 
@@ -33,4 +35,5 @@ func init() {
 	GlobalStatus = NewStatus(name)
 	GlobalStatus.DisplayName = name
 	GlobalStatus.FQDN = fqdn
+	GlobalProbes = NewProbes(GlobalStatus)
 }
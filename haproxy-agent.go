@@ -0,0 +1,173 @@
+package mon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HaproxyAgentConfig configures HAProxy agent-check listener
+type HaproxyAgentConfig struct {
+	// TCP address to listen on, like ":8081" (required)
+	Address string
+	// Status to report, defaults to GlobalStatus
+	Status *Status
+	// Weight returns weight percentage sent along with `up`. If nil or ok is false weight is not sent.
+	// See AgentWeightFromMetric()
+	Weight func() (percent int, ok bool)
+	// Timeout for sending the reply, defaults to 2s
+	Timeout time.Duration
+}
+
+// HaproxyAgent answers HAProxy's `agent-check` with state of the Status:
+//
+// * Ok as `up ready` (with weight if configured)
+// * Warning as `up drain` (`up` so server marked down by previous reply comes back, but gets no new traffic)
+// * Critical, Unknown and Invalid as `down`
+// * status in maintenance (SetMaintenance()) as `maint`
+//
+// `ready` cancels drain/maint set by previous replies. HAProxy's side:
+//
+//	server app1 10.0.0.1:8080 check agent-check agent-port 8081 agent-inter 2s
+type HaproxyAgent struct {
+	cfg HaproxyAgentConfig
+	l   net.Listener
+}
+
+// NewHaproxyAgent creates agent-check server and binds the listener; call Run() to start answering
+func NewHaproxyAgent(cfg HaproxyAgentConfig) (*HaproxyAgent, error) {
+	if cfg.Address == "" {
+		return nil, fmt.Errorf("haproxy agent needs an address to listen on")
+	}
+	if cfg.Status == nil {
+		cfg.Status = GlobalStatus
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = time.Second * 2
+	}
+	l, err := net.Listen("tcp", cfg.Address)
+	if err != nil {
+		return nil, fmt.Errorf("error listening on tcp %s: %w", cfg.Address, err)
+	}
+	return &HaproxyAgent{cfg: cfg, l: l}, nil
+}
+
+// Addr returns address listener is bound to
+func (a *HaproxyAgent) Addr() net.Addr {
+	return a.l.Addr()
+}
+
+// Run answers agent checks until context is cancelled, then closes the listener
+func (a *HaproxyAgent) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		<-ctx.Done()
+		a.l.Close()
+	}()
+	var tempDelay time.Duration
+	for {
+		conn, err := a.l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) || ctx.Err() != nil {
+				break
+			}
+			// back off like net/http does, so e.g. running out of file descriptors does not spin the CPU
+			tempDelay = acceptBackoff(tempDelay)
+			select {
+			case <-time.After(tempDelay):
+			case <-ctx.Done():
+			}
+			continue
+		}
+		tempDelay = 0
+		go func() {
+			defer conn.Close()
+			conn.SetWriteDeadline(time.Now().Add(a.cfg.Timeout))
+			conn.Write([]byte(a.Reply() + "\n"))
+		}()
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+// Reply returns agent-check reply for current state of the status, without trailing newline
+func (a *HaproxyAgent) Reply() string {
+	s := a.cfg.Status
+	if s.InMaintenance() {
+		return "maint"
+	}
+	switch s.GetState() {
+	case StateOk:
+		if a.cfg.Weight != nil {
+			if percent, ok := a.cfg.Weight(); ok {
+				return fmt.Sprintf("up ready %d%%", clampPercent(percent))
+			}
+		}
+		return "up ready"
+	case StateWarning:
+		return "up drain"
+	default:
+		msg := strings.Map(func(r rune) rune {
+			if r == '\n' || r == '\r' {
+				return ' '
+			}
+			return r
+		}, s.GetMessage())
+		if msg == "" {
+			return "down"
+		}
+		return "down #" + msg
+	}
+}
+
+// AgentWeightFromMetric returns Weight function deriving weight from metric in the registry.
+// Weight is 100% when metric is at or below idle, minPercent when it is at or above busy and scales linearly between.
+// If idle is bigger than busy the scale is reversed (e.g. for free capacity). Weight is not sent if metric does not exist
+//
+//	Weight: mon.AgentWeightFromMetric(mon.GlobalRegistry, "http.concurrency", 10, 200, 10)
+func AgentWeightFromMetric(r *Registry, name string, idle float64, busy float64, minPercent int) func() (int, bool) {
+	minPercent = clampPercent(minPercent)
+	return func() (int, bool) {
+		m, err := r.GetMetric(name)
+		if err != nil || idle == busy {
+			return 0, false
+		}
+		frac := (m.Value() - idle) / (busy - idle)
+		if math.IsNaN(frac) {
+			return 0, false
+		} else if frac < 0 {
+			frac = 0
+		} else if frac > 1 {
+			frac = 1
+		}
+		return 100 - int(frac*float64(100-minPercent)+0.5), true
+	}
+}
+
+// acceptBackoff returns delay before retrying failed Accept(), doubling previous one from 5ms up to 1s
+func acceptBackoff(prev time.Duration) time.Duration {
+	if prev == 0 {
+		return 5 * time.Millisecond
+	}
+	if prev*2 > time.Second {
+		return time.Second
+	}
+	return prev * 2
+}
+
+func clampPercent(p int) int {
+	if p < 0 {
+		return 0
+	}
+	if p > 100 {
+		return 100
+	}
+	return p
+}
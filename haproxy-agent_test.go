@@ -0,0 +1,125 @@
+package mon
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHaproxyAgentReply(t *testing.T) {
+	s := NewStatus("app")
+	a := &HaproxyAgent{cfg: HaproxyAgentConfig{Status: s}}
+	assert.Equal(t, "down", a.Reply(), "invalid state")
+	s.MustUpdate(StateOk, "ok")
+	assert.Equal(t, "up ready", a.Reply())
+	s.MustUpdate(StateWarning, "shutting down")
+	assert.Equal(t, "up drain", a.Reply())
+	s.MustUpdate(StateCritical, "db\ndown")
+	assert.Equal(t, "down #db down", a.Reply())
+	s.MustUpdate(StateUnknown, "")
+	assert.Equal(t, "down", a.Reply())
+	s.SetMaintenance("upgrade", time.Time{})
+	assert.Equal(t, "maint", a.Reply())
+	s.ClearMaintenance()
+	s.MustUpdate(StateOk, "ok")
+	a.cfg.Weight = func() (int, bool) { return 150, true }
+	assert.Equal(t, "up ready 100%", a.Reply())
+	a.cfg.Weight = func() (int, bool) { return 0, false }
+	assert.Equal(t, "up ready", a.Reply())
+}
+
+func TestAgentWeightFromMetric(t *testing.T) {
+	r, err := NewRegistry("", "", 10)
+	require.NoError(t, err)
+	weight := AgentWeightFromMetric(r, "concurrency", 10, 110, 20)
+	_, ok := weight()
+	assert.False(t, ok, "no metric")
+	m := r.MustRegister("concurrency", NewGauge())
+	for value, expected := range map[float64]int{0: 100, 10: 100, 60: 60, 110: 20, 500: 20} {
+		m.Update(value)
+		w, ok := weight()
+		assert.True(t, ok)
+		assert.Equal(t, expected, w, "value %f", value)
+	}
+	free := AgentWeightFromMetric(r, "concurrency", 100, 0, 0)
+	m.Update(25)
+	w, _ := free()
+	assert.Equal(t, 25, w, "reversed scale")
+}
+
+func TestHaproxyAgent(t *testing.T) {
+	s := NewStatus("app")
+	s.MustUpdate(StateOk, "ok")
+	a, err := NewHaproxyAgent(HaproxyAgentConfig{
+		Address: "127.0.0.1:0",
+		Status:  s,
+		Weight:  func() (int, bool) { return 50, true },
+	})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- a.Run(ctx) }()
+
+	check := func() string {
+		conn, err := net.Dial("tcp", a.Addr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+		reply, err := io.ReadAll(conn)
+		require.NoError(t, err)
+		return string(reply)
+	}
+	assert.Equal(t, "up ready 50%\n", check())
+	s.MustUpdate(StateWarning, "draining")
+	assert.Equal(t, "up drain\n", check())
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+	_, err = net.Dial("tcp", a.Addr().String())
+	assert.Error(t, err, "listener closed")
+
+	_, err = NewHaproxyAgent(HaproxyAgentConfig{})
+	assert.Error(t, err)
+}
+
+type failingListener struct {
+	net.Listener
+	closed  chan struct{}
+	accepts int
+}
+
+func (l *failingListener) Accept() (net.Conn, error) {
+	select {
+	case <-l.closed:
+		return nil, net.ErrClosed
+	default:
+	}
+	l.accepts++
+	return nil, errors.New("too many open files")
+}
+
+func (l *failingListener) Close() error {
+	close(l.closed)
+	return l.Listener.Close()
+}
+
+func TestHaproxyAgentAcceptBackoff(t *testing.T) {
+	assert.Equal(t, 5*time.Millisecond, acceptBackoff(0))
+	assert.Equal(t, 10*time.Millisecond, acceptBackoff(5*time.Millisecond))
+	assert.Equal(t, time.Second, acceptBackoff(640*time.Millisecond))
+	assert.Equal(t, time.Second, acceptBackoff(time.Second))
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	fl := &failingListener{Listener: l, closed: make(chan struct{})}
+	a := &HaproxyAgent{cfg: HaproxyAgentConfig{Status: NewStatus("app")}, l: fl}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	a.Run(ctx)
+	assert.Less(t, fl.accepts, 10, "accept errors should be retried with backoff")
+}
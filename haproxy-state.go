@@ -0,0 +1,178 @@
+package mon
+
+import (
+	"sort"
+	"time"
+)
+
+// DefaultHaproxyNodeExpiry is how long LB node that stopped checking the server is kept; after that it is removed
+// and not taken into account by SafeToStop()
+var DefaultHaproxyNodeExpiry = time.Minute
+
+// HaproxyNodeState is state of the server as seen by single haproxy (LB node)
+type HaproxyNodeState struct {
+	Node               string    `json:"node"`
+	Backend            string    `json:"backend"`
+	Server             string    `json:"server"`
+	State              State     `json:"state"`
+	ServerWeight       int       `json:"server_weight"`
+	TotalWeight        int       `json:"total_weight"`
+	ServerConnections  int       `json:"server_connections"`
+	BackendConnections int       `json:"backend_connections"`
+	Queue              int       `json:"queue"`
+	TS                 time.Time `json:"ts"`
+}
+
+// haproxyNodeMetrics are gauges exported for each LB node
+var haproxyNodeMetrics = []string{
+	"haproxy.state",
+	"haproxy.server_weight",
+	"haproxy.total_weight",
+	"haproxy.server_connections",
+	"haproxy.backend_connections",
+	"haproxy.queue",
+}
+
+// Nodes returns last state reported by each LB node, sorted by node name.
+// Node name is taken from `node=` part of the header and is empty if haproxy did not send it
+func (s *HaproxyState) Nodes() []HaproxyNodeState {
+	s.Lock()
+	defer s.Unlock()
+	s.pruneNodes()
+	nodes := make([]HaproxyNodeState, 0, len(s.nodes))
+	for _, n := range s.nodes {
+		nodes = append(nodes, *n)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Node < nodes[j].Node })
+	return nodes
+}
+
+// SetNodeExpiry sets after how long LB node that stopped checking the server (e.g. was removed) is removed,
+// along with its gauges. Defaults to DefaultHaproxyNodeExpiry
+func (s *HaproxyState) SetNodeExpiry(d time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+	s.nodeExpiry = d
+	s.pruneNodes()
+}
+
+// SetRegistry makes each check update gauges in the registry, labelled by `lb_node` and `backend`:
+//
+// * haproxy.state - State of the server as seen by LB
+// * haproxy.server_weight and haproxy.total_weight
+// * haproxy.server_connections and haproxy.backend_connections
+// * haproxy.queue
+func (s *HaproxyState) SetRegistry(r *Registry) {
+	s.Lock()
+	defer s.Unlock()
+	s.registry = r
+	for _, n := range s.nodes {
+		s.updateMetrics(n)
+	}
+}
+
+// nodesSafeToStop returns true if every LB node that checked the server recently marked it down
+// and has no connections to it. Lock must be held
+func (s *HaproxyState) nodesSafeToStop() bool {
+	for _, n := range s.nodes {
+		if s.nodeExpired(n) {
+			continue
+		}
+		if n.State == StateOk || n.Queue > 0 || n.ServerConnections > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *HaproxyState) nodeExpired(n *HaproxyNodeState) bool {
+	expiry := s.nodeExpiry
+	if expiry <= 0 {
+		expiry = DefaultHaproxyNodeExpiry
+	}
+	return time.Since(n.TS) > expiry
+}
+
+// pruneNodes removes nodes that did not check the server for longer than node expiry. Lock must be held
+func (s *HaproxyState) pruneNodes() {
+	for name, n := range s.nodes {
+		if s.nodeExpired(n) {
+			delete(s.nodes, name)
+			s.removeMetrics(n)
+		}
+	}
+}
+
+// updateNode records state of LB node that sent the header and removes expired ones. Lock must be held
+func (s *HaproxyState) updateNode(new *HaproxyState) {
+	if s.nodes == nil {
+		s.nodes = make(map[string]*HaproxyNodeState)
+	}
+	s.nodesSeen = true
+	s.pruneNodes()
+	if old, ok := s.nodes[new.LBNodeName]; ok && old.Backend != new.BackendName {
+		s.removeMetrics(old)
+	}
+	n := &HaproxyNodeState{
+		Node:               new.LBNodeName,
+		Backend:            new.BackendName,
+		Server:             new.ServerName,
+		State:              new.State,
+		ServerWeight:       new.ServerWeight,
+		TotalWeight:        new.TotalWeight,
+		ServerConnections:  new.ServerCurrentConnections,
+		BackendConnections: new.BackendCurrentConnections,
+		Queue:              new.Queue,
+		TS:                 new.TS,
+	}
+	s.nodes[n.Node] = n
+	s.updateMetrics(n)
+}
+
+func (s *HaproxyState) updateMetrics(n *HaproxyNodeState) {
+	if s.registry == nil {
+		return
+	}
+	values := []int{int(n.State), n.ServerWeight, n.TotalWeight, n.ServerConnections, n.BackendConnections, n.Queue}
+	for i, name := range haproxyNodeMetrics {
+		m, err := s.registry.RegisterOrGet(name, NewGauge(), haproxyNodeTags(n))
+		if err != nil {
+			continue
+		}
+		m.Update(float64(values[i]))
+	}
+}
+
+func (s *HaproxyState) removeMetrics(n *HaproxyNodeState) {
+	if s.registry == nil {
+		return
+	}
+	for _, name := range haproxyNodeMetrics {
+		s.registry.Unregister(name, haproxyNodeTags(n))
+	}
+}
+
+func haproxyNodeTags(n *HaproxyNodeState) map[string]string {
+	return map[string]string{"lb_node": n.Node, "backend": n.Backend}
+}
+
+// statusWithHaproxy is used to render health JSON with state of the LB nodes included
+type statusWithHaproxy struct {
+	*Status
+	Haproxy []HaproxyNodeState `json:"haproxy,omitempty"`
+}
+
+type statusWithHistoryAndHaproxy struct {
+	*statusWithHistory
+	Haproxy []HaproxyNodeState `json:"haproxy,omitempty"`
+}
+
+func withHaproxy(status interface{}, nodes []HaproxyNodeState) interface{} {
+	switch s := status.(type) {
+	case *Status:
+		return &statusWithHaproxy{Status: s, Haproxy: nodes}
+	case *statusWithHistory:
+		return &statusWithHistoryAndHaproxy{statusWithHistory: s, Haproxy: nodes}
+	}
+	return status
+}
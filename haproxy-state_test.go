@@ -0,0 +1,147 @@
+package mon
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withTestGlobalStatus replaces GlobalStatus for the duration of the test
+func withTestGlobalStatus(t *testing.T) {
+	global := GlobalStatus
+	t.Cleanup(func() { GlobalStatus = global })
+	GlobalStatus = NewStatus("test")
+}
+
+func haproxyCheck(t *testing.T, handler func(w http.ResponseWriter, req *http.Request), url string, header string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest("GET", url, nil)
+	require.NoError(t, err)
+	if header != "" {
+		req.Header.Add("X-Haproxy-Server-State", header)
+	}
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	return rr
+}
+
+func TestHaproxyStateNodes(t *testing.T) {
+	withTestGlobalStatus(t)
+	GlobalStatus.Update(StatusOk, "service-running")
+	r, err := NewRegistry("", "", 10)
+	require.NoError(t, err)
+	handler, haproxy := HandleHealthchecksHaproxy()
+	haproxy.SetRegistry(r)
+	haproxyCheck(t, handler, "/", "UP 2/3; name=bck/srv2; node=lb2; weight=1/2; scur=3/22; qcur=1")
+	haproxyCheck(t, handler, "/", "NOLB 2/3; name=bck/srv2; node=lb1; weight=2/4; scur=5/10; qcur=0")
+	haproxyCheck(t, handler, "/", "")
+
+	nodes := haproxy.Nodes()
+	require.Len(t, nodes, 2)
+	assert.Equal(t, "lb1", nodes[0].Node)
+	assert.Equal(t, StateWarning, nodes[0].State)
+	assert.Equal(t, 5, nodes[0].ServerConnections)
+	assert.Equal(t, "lb2", nodes[1].Node)
+	assert.Equal(t, "bck", nodes[1].Backend)
+	assert.Equal(t, "srv2", nodes[1].Server)
+	assert.Equal(t, StateOk, nodes[1].State)
+	assert.Equal(t, 1, nodes[1].ServerWeight)
+	assert.Equal(t, 2, nodes[1].TotalWeight)
+	assert.Equal(t, 3, nodes[1].ServerConnections)
+	assert.Equal(t, 22, nodes[1].BackendConnections)
+	assert.Equal(t, 1, nodes[1].Queue)
+	haproxy.RLock()
+	assert.Equal(t, "lb1", haproxy.LBNodeName, "last checked node")
+	haproxy.RUnlock()
+
+	scur, err := r.GetMetric("haproxy.server_connections", map[string]string{"lb_node": "lb2", "backend": "bck"})
+	require.NoError(t, err)
+	assert.Equal(t, 3.0, scur.Value())
+	state, err := r.GetMetric("haproxy.state", map[string]string{"lb_node": "lb1", "backend": "bck"})
+	require.NoError(t, err)
+	assert.Equal(t, float64(StateWarning), state.Value())
+
+	// registry set later gets current state of the nodes
+	r2, err := NewRegistry("", "", 10)
+	require.NoError(t, err)
+	haproxy.SetRegistry(r2)
+	queue, err := r2.GetMetric("haproxy.queue", map[string]string{"lb_node": "lb2", "backend": "bck"})
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, queue.Value())
+}
+
+func TestHaproxyStateJSON(t *testing.T) {
+	withTestGlobalStatus(t)
+	GlobalStatus.Update(StatusOk, "service-running")
+	handler, _ := HandleHealthchecksHaproxy(true)
+	rr := haproxyCheck(t, handler, "/", "UP 2/3; name=bck/srv2; node=lb1; weight=1/2; scur=3/22; qcur=0")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var out struct {
+		State   State              `json:"state"`
+		Haproxy []HaproxyNodeState `json:"haproxy"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &out))
+	assert.Equal(t, StateOk, out.State)
+	require.Len(t, out.Haproxy, 1)
+	assert.Equal(t, "lb1", out.Haproxy[0].Node)
+	assert.Equal(t, 3, out.Haproxy[0].ServerConnections)
+
+	rr = haproxyCheck(t, handler, "/?history=1", "")
+	assert.Contains(t, rr.Body.String(), `"haproxy":[{"node":"lb1"`)
+	assert.Contains(t, rr.Body.String(), `"history":`)
+
+	handler, _ = HandleHealthchecksHaproxy()
+	rr = haproxyCheck(t, handler, "/", "")
+	assert.NotContains(t, rr.Body.String(), `"haproxy"`, "no LB seen yet")
+	assert.Contains(t, rr.Body.String(), "service-running")
+}
+
+func TestHaproxyStateSafeToStop(t *testing.T) {
+	withTestGlobalStatus(t)
+	handler, haproxy := HandleHealthchecksHaproxy()
+	haproxyCheck(t, handler, "/", "DOWN 0/3; name=bck/srv2; node=lb1; weight=1/2; scur=0/22; qcur=0")
+	assert.True(t, haproxy.SafeToStop(), "single LB marked us down")
+	haproxyCheck(t, handler, "/", "UP 2/3; name=bck/srv2; node=lb2; weight=1/2; scur=4/22; qcur=0")
+	assert.False(t, haproxy.SafeToStop(), "lb2 still routes traffic")
+	haproxyCheck(t, handler, "/", "NOLB 2/3; name=bck/srv2; node=lb2; weight=1/2; scur=4/22; qcur=0")
+	assert.False(t, haproxy.SafeToStop(), "lb2 still has connections")
+	haproxyCheck(t, handler, "/", "NOLB 2/3; name=bck/srv2; node=lb2; weight=1/2; scur=0/22; qcur=0")
+	assert.True(t, haproxy.SafeToStop(), "both LBs agree")
+	haproxyCheck(t, handler, "/", "UP 2/3; name=bck/srv2; node=lb1; weight=1/2; scur=0/22; qcur=0")
+	assert.False(t, haproxy.SafeToStop(), "lb1 marked us up again")
+
+	// lb1 stops checking
+	r, err := NewRegistry("", "", 10)
+	require.NoError(t, err)
+	haproxy.SetRegistry(r)
+	haproxy.SetNodeExpiry(time.Hour)
+	haproxy.update(&HaproxyState{State: StateOk, LBNodeName: "lb1", BackendName: "bck", Found: true, TS: time.Now().Add(-time.Minute * 2)})
+	assert.False(t, haproxy.SafeToStop(), "lb1 did not expire yet")
+	lb1 := map[string]string{"lb_node": "lb1", "backend": "bck"}
+	_, err = r.GetMetric("haproxy.state", lb1)
+	require.NoError(t, err)
+
+	haproxy.SetNodeExpiry(time.Minute)
+	assert.True(t, haproxy.SafeToStop(), "expired LB is ignored")
+	nodes := haproxy.Nodes()
+	require.Len(t, nodes, 1, "expired LB is removed")
+	assert.Equal(t, "lb2", nodes[0].Node)
+	_, err = r.GetMetric("haproxy.state", lb1)
+	assert.Error(t, err, "gauges of expired LB are removed")
+	_, err = r.GetMetric("haproxy.state", map[string]string{"lb_node": "lb2", "backend": "bck"})
+	assert.NoError(t, err)
+
+	// lb2 moves the server to other backend
+	haproxyCheck(t, handler, "/", "NOLB 2/3; name=bck2/srv2; node=lb2; weight=1/2; scur=0/22; qcur=0")
+	_, err = r.GetMetric("haproxy.state", map[string]string{"lb_node": "lb2", "backend": "bck"})
+	assert.Error(t, err, "gauges of old backend are removed")
+
+	// all LBs stopped checking
+	haproxy.update(&HaproxyState{State: StateOk, LBNodeName: "lb2", BackendName: "bck2", Found: true, TS: time.Now().Add(-time.Minute * 2)})
+	assert.True(t, haproxy.SafeToStop(), "nothing routes to us")
+	assert.Empty(t, haproxy.Nodes())
+}
@@ -0,0 +1,125 @@
+package mon
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"sync"
+)
+
+const MetricTypeHistogram = `h` // float64 histogram
+
+// DefaultHistogramBuckets are upper bounds used when histogram is created without buckets
+var DefaultHistogramBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// HistogramSnapshot is point-in-time copy of histogram state.
+// Counts are cumulative, Counts[i] is number of observations <= Buckets[i]
+type HistogramSnapshot struct {
+	Buckets []float64 `json:"buckets"`
+	Counts  []uint64  `json:"counts"`
+	Count   uint64    `json:"count"`
+	Sum     float64   `json:"sum"`
+}
+
+// Histogram is a metric that also exposes bucketed distribution of observed values
+type Histogram interface {
+	Metric
+	HistogramSnapshot() HistogramSnapshot
+}
+
+type MetricHistogram struct {
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+	unit    string
+	lock    sync.RWMutex
+}
+
+// NewHistogram creates histogram with given bucket upper bounds, DefaultHistogramBuckets are used if buckets are empty
+// Value() of histogram returns mean of all observations
+func NewHistogram(buckets []float64, unit ...string) Metric {
+	if len(buckets) == 0 {
+		buckets = DefaultHistogramBuckets
+	}
+	m := MetricHistogram{
+		buckets: make([]float64, len(buckets)),
+	}
+	copy(m.buckets, buckets)
+	sort.Float64s(m.buckets)
+	m.counts = make([]uint64, len(m.buckets))
+	if len(unit) > 0 {
+		m.unit = unit[0]
+	}
+	return &m
+}
+
+func (m *MetricHistogram) Type() string {
+	return MetricTypeHistogram
+}
+
+// Update adds observation to the histogram
+func (m *MetricHistogram) Update(v float64) {
+	m.updateN(v, 1)
+}
+
+// updateN adds n observations of the same value
+func (m *MetricHistogram) updateN(v float64, n uint64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	i := sort.SearchFloat64s(m.buckets, v)
+	if i < len(m.counts) {
+		m.counts[i] += n
+	}
+	m.count += n
+	m.sum += v * float64(n)
+}
+func (m *MetricHistogram) Unit() string {
+	return m.unit
+}
+func (m *MetricHistogram) Value() float64 {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	if m.count == 0 {
+		return 0
+	}
+	return m.sum / float64(m.count)
+}
+
+func (m *MetricHistogram) HistogramSnapshot() HistogramSnapshot {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	s := HistogramSnapshot{
+		Buckets: make([]float64, len(m.buckets)),
+		Counts:  make([]uint64, len(m.counts)),
+		Count:   m.count,
+		Sum:     m.sum,
+	}
+	copy(s.Buckets, m.buckets)
+	var cumulative uint64
+	for i, c := range m.counts {
+		cumulative += c
+		s.Counts[i] = cumulative
+	}
+	return s
+}
+
+func (m *MetricHistogram) MarshalJSON() ([]byte, error) {
+	v := m.Value()
+	// Go bug #3480 #25721
+	// returning number is only option, or else Go (or other strict deserializers) will crap out on ingestion
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return json.Marshal(
+			JSONOut{
+				Type:    MetricTypeHistogram,
+				Invalid: true,
+				Unit:    m.unit,
+			})
+	}
+	return json.Marshal(
+		JSONOut{
+			Type:  MetricTypeHistogram,
+			Value: v,
+			Unit:  m.unit,
+		})
+}
@@ -0,0 +1,27 @@
+package mon
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram([]float64{10, 1, 5}, "ms")
+	assert.Equal(t, MetricTypeHistogram, h.Type())
+	assert.Equal(t, 0.0, h.Value(), "empty histogram")
+	h.Update(0.5)
+	h.Update(3)
+	h.Update(4)
+	h.Update(100)
+	assert.Equal(t, 26.875, h.Value(), "mean")
+	snap := h.(Histogram).HistogramSnapshot()
+	assert.Equal(t, []float64{1, 5, 10}, snap.Buckets, "sorted buckets")
+	assert.Equal(t, []uint64{1, 3, 3}, snap.Counts, "cumulative counts")
+	assert.Equal(t, uint64(4), snap.Count)
+	assert.Equal(t, 107.5, snap.Sum)
+	m, err := json.Marshal(h)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"type":"h","unit":"ms","value":26.875}`, string(m))
+}
@@ -0,0 +1,296 @@
+package mon
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var nagiosStateNames = map[State]string{
+	StateOk:       "OK",
+	StateWarning:  "WARNING",
+	StateCritical: "CRITICAL",
+	StateUnknown:  "UNKNOWN",
+}
+
+// pipe separates perfdata so it can't be in plugin's text output
+var nagiosTextRepl = strings.NewReplacer(
+	"|", "/",
+	"\n", " ",
+)
+
+// NagiosRange is threshold range in nagios plugin format:
+//
+// * `10` - alert if < 0 or > 10
+// * `10:` - alert if < 10
+// * `~:10` - alert if > 10
+// * `10:20` - alert if < 10 or > 20
+// * `@10:20` - alert if >= 10 and <= 20
+type NagiosRange struct {
+	Start float64
+	End   float64
+	// alert when value is inside the range instead of outside
+	Inside bool
+	raw    string
+}
+
+func ParseNagiosRange(s string) (r NagiosRange, err error) {
+	r.raw = s
+	r.End = math.Inf(1)
+	if strings.HasPrefix(s, "@") {
+		r.Inside = true
+		s = s[1:]
+	}
+	if s == "" {
+		return r, fmt.Errorf("empty range")
+	}
+	start, end, hasColon := strings.Cut(s, ":")
+	if !hasColon {
+		start, end = "0", s
+	}
+	switch start {
+	case "~":
+		r.Start = math.Inf(-1)
+	case "":
+		r.Start = 0
+	default:
+		r.Start, err = strconv.ParseFloat(start, 64)
+		if err != nil {
+			return r, fmt.Errorf("bad range start in [%s]: %w", r.raw, err)
+		}
+	}
+	if end != "" {
+		r.End, err = strconv.ParseFloat(end, 64)
+		if err != nil {
+			return r, fmt.Errorf("bad range end in [%s]: %w", r.raw, err)
+		}
+	}
+	if r.Start > r.End {
+		return r, fmt.Errorf("range start is bigger than end in [%s]", r.raw)
+	}
+	return r, nil
+}
+
+// Alert returns true if value should raise an alert
+func (r NagiosRange) Alert(v float64) bool {
+	inside := v >= r.Start && v <= r.End
+	if r.Inside {
+		return inside
+	}
+	return !inside
+}
+
+func (r NagiosRange) String() string {
+	return r.raw
+}
+
+// NagiosPerf is single performance data entry
+type NagiosPerf struct {
+	Label    string
+	Value    float64
+	UOM      string
+	Warning  string
+	Critical string
+	Min      string
+	Max      string
+}
+
+// String returns perfdata in `'label'=value[UOM];[warn];[crit];[min];[max]` format
+func (p NagiosPerf) String() string {
+	label := p.Label
+	if strings.ContainsAny(label, " '=") {
+		label = "'" + strings.ReplaceAll(label, "'", "''") + "'"
+	}
+	out := label + "=" + strconv.FormatFloat(p.Value, 'f', -1, 64) + p.UOM +
+		";" + p.Warning + ";" + p.Critical + ";" + p.Min + ";" + p.Max
+	return strings.TrimRight(out, ";")
+}
+
+// NagiosResult is result of the check in nagios plugin format
+type NagiosResult struct {
+	State      State
+	Message    string
+	LongOutput []string
+	Perfdata   []NagiosPerf
+}
+
+// NewNagiosResult creates result from the Status, with a line of long output for each component
+func NewNagiosResult(s *Status) NagiosResult {
+	n := NagiosResult{
+		State:   s.GetState(),
+		Message: s.GetMessage(),
+	}
+	walkStatus(s, nil, func(path []string, c *Status) {
+		if len(path) == 0 {
+			return
+		}
+		n.LongOutput = append(n.LongOutput, fmt.Sprintf("[%s] %s: %s", nagiosStateName(c.GetState()), strings.Join(path, "/"), c.GetMessage()))
+	})
+	return n
+}
+
+// Raise adds message to long output. If state is worse than current the result takes it and message
+// replaces first line of the output, so it names the cause
+func (n *NagiosResult) Raise(state State, message string) {
+	if worseState(state, n.State) {
+		n.State = state
+		n.Message = message
+	}
+	n.LongOutput = append(n.LongOutput, fmt.Sprintf("[%s] %s", nagiosStateName(state), message))
+}
+
+// AddPerf adds perfdata value and checks it against warning/critical thresholds (if any), raising state when they are exceeded
+func (n *NagiosResult) AddPerf(p NagiosPerf) error {
+	for _, t := range []struct {
+		threshold string
+		state     State
+	}{{p.Critical, StateCritical}, {p.Warning, StateWarning}} {
+		if t.threshold == "" {
+			continue
+		}
+		r, err := ParseNagiosRange(t.threshold)
+		if err != nil {
+			return fmt.Errorf("%s: %w", p.Label, err)
+		}
+		if r.Alert(p.Value) {
+			n.Raise(t.state, fmt.Sprintf("%s=%s%s outside of %s", p.Label, strconv.FormatFloat(p.Value, 'f', -1, 64), p.UOM, t.threshold))
+			break
+		}
+	}
+	n.Perfdata = append(n.Perfdata, p)
+	return nil
+}
+
+// ExitCode returns plugin exit code
+func (n NagiosResult) ExitCode() int {
+	return n.State.NagiosCode()
+}
+
+// String returns plugin output, `STATE - message | perfdata` followed by long output
+func (n NagiosResult) String() string {
+	var b strings.Builder
+	b.WriteString(nagiosStateName(n.State))
+	b.WriteString(" - ")
+	b.WriteString(nagiosTextRepl.Replace(n.Message))
+	if len(n.Perfdata) > 0 {
+		perf := make([]string, len(n.Perfdata))
+		for i, p := range n.Perfdata {
+			perf[i] = p.String()
+		}
+		b.WriteString(" | ")
+		b.WriteString(strings.Join(perf, " "))
+	}
+	b.WriteString("\n")
+	for _, l := range n.LongOutput {
+		b.WriteString(nagiosTextRepl.Replace(l))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func nagiosStateName(s State) string {
+	if name, ok := nagiosStateNames[s]; ok {
+		return name
+	}
+	return nagiosStateNames[StateUnknown]
+}
+
+// worseState returns true if a is worse than b; critical > unknown > warning > ok > invalid, same as in SummarizeStatusState
+func worseState(a State, b State) bool {
+	rank := func(s State) int {
+		switch s {
+		case StateCritical:
+			return 4
+		case StateUnknown:
+			return 3
+		case StateWarning:
+			return 2
+		case StateOk:
+			return 1
+		}
+		return 0
+	}
+	return rank(a) > rank(b)
+}
+
+// NagiosUnit converts value and unit to nagios unit of measurement.
+// Units not supported by nagios are dropped, counters without unit get `c`
+func NagiosUnit(value float64, unit string, metricType string) (float64, string) {
+	switch unit {
+	case "s", "seconds":
+		return value, "s"
+	case "ms", "milliseconds":
+		return value, "ms"
+	case "us":
+		return value, "us"
+	case "ns":
+		return value / 1000, "us"
+	case "percent", "%":
+		return value, "%"
+	case "bytes", "B":
+		return value, "B"
+	}
+	if unit == "" && (metricType == MetricTypeCounter || metricType == MetricTypeCounterFloat) {
+		return value, "c"
+	}
+	return value, ""
+}
+
+// NagiosMetric selects registry metric to add as perfdata
+type NagiosMetric struct {
+	// Metric name in registry
+	Name string
+	// Metric labels
+	Tags map[string]string
+	// Label in perfdata, defaults to metric name
+	Label string
+	// Warning and critical thresholds, in nagios range format
+	Warning  string
+	Critical string
+	Min      string
+	Max      string
+}
+
+// RenderNagios renders status and selected metrics from the registry as nagios check result.
+// Missing metrics and exceeded thresholds raise the state of the result
+func RenderNagios(s *Status, r *Registry, metrics ...NagiosMetric) NagiosResult {
+	n := NewNagiosResult(s)
+	for _, m := range metrics {
+		label := m.Label
+		if label == "" {
+			label = m.Name
+		}
+		metric, err := r.GetMetric(m.Name, m.Tags)
+		if err != nil {
+			n.Raise(StateUnknown, err.Error())
+			continue
+		}
+		value, uom := NagiosUnit(metric.Value(), metric.Unit(), metric.Type())
+		err = n.AddPerf(NagiosPerf{
+			Label:    label,
+			Value:    value,
+			UOM:      uom,
+			Warning:  m.Warning,
+			Critical: m.Critical,
+			Min:      m.Min,
+			Max:      m.Max,
+		})
+		if err != nil {
+			n.Raise(StateUnknown, err.Error())
+		}
+	}
+	return n
+}
+
+// HandleNagios returns handler rendering status and selected metrics in nagios plugin format.
+// Exit code is also returned in `X-Nagios-Exit-Code` header
+func HandleNagios(s *Status, r *Registry, metrics ...NagiosMetric) func(w http.ResponseWriter, req *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		n := RenderNagios(s, r, metrics...)
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("X-Nagios-Exit-Code", strconv.Itoa(n.ExitCode()))
+		w.Write([]byte(n.String()))
+	}
+}
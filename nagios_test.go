@@ -0,0 +1,114 @@
+package mon
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseNagiosRange(t *testing.T) {
+	for _, tc := range []struct {
+		r     string
+		alert []float64
+		ok    []float64
+	}{
+		{"10", []float64{-1, 11}, []float64{0, 5, 10}},
+		{"10:", []float64{9.9, -1}, []float64{10, 1000}},
+		{"~:10", []float64{11}, []float64{-1000, 10}},
+		{"10:20", []float64{9, 21}, []float64{10, 15, 20}},
+		{"@10:20", []float64{10, 15, 20}, []float64{9, 21}},
+	} {
+		r, err := ParseNagiosRange(tc.r)
+		require.NoError(t, err, tc.r)
+		assert.Equal(t, tc.r, r.String())
+		for _, v := range tc.alert {
+			assert.True(t, r.Alert(v), "%s should alert on %f", tc.r, v)
+		}
+		for _, v := range tc.ok {
+			assert.False(t, r.Alert(v), "%s should not alert on %f", tc.r, v)
+		}
+	}
+	for _, bad := range []string{"", "@", "abc", "20:10", "1:x"} {
+		_, err := ParseNagiosRange(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestNagiosPerf(t *testing.T) {
+	assert.Equal(t, "room=23.4", NagiosPerf{Label: "room", Value: 23.4}.String())
+	assert.Equal(t, "'disk free'=10B;20:;10:;0", NagiosPerf{Label: "disk free", Value: 10, UOM: "B", Warning: "20:", Critical: "10:", Min: "0"}.String())
+	assert.Equal(t, "'it''s'=1;;;;100", NagiosPerf{Label: "it's", Value: 1, Max: "100"}.String())
+}
+
+func TestRenderNagios(t *testing.T) {
+	s := NewStatus("app")
+	db := s.MustNewComponent("db")
+	web := s.MustNewComponent("web")
+	require.NoError(t, db.Update(StateOk, "running"))
+	require.NoError(t, web.Update(StateWarning, "slow | very"))
+	r, err := NewRegistry("", "", 10)
+	require.NoError(t, err)
+	r.MustRegister("room", NewGauge("temperature")).Update(23.4)
+	r.MustRegister("web.requests", NewCounter()).Update(10)
+	r.MustRegister("web.latency", NewGauge("ns")).Update(1500)
+
+	n := RenderNagios(s, r,
+		NagiosMetric{Name: "room", Warning: "25", Critical: "30"},
+		NagiosMetric{Name: "web.requests", Label: "requests"},
+		NagiosMetric{Name: "web.latency"},
+	)
+	assert.Equal(t, StateWarning, n.State)
+	assert.Equal(t, 1, n.ExitCode())
+	lines := strings.Split(n.String(), "\n")
+	assert.Equal(t, "WARNING - W:[web]slow / very -=#=- [db]running | room=23.4;25;30 requests=10c web.latency=1.5us", lines[0])
+	assert.Equal(t, "[OK] db: running", lines[1])
+	assert.Equal(t, "[WARNING] web: slow / very", lines[2])
+
+	t.Run("thresholds", func(t *testing.T) {
+		n := RenderNagios(s, r, NagiosMetric{Name: "room", Warning: "20", Critical: "22"})
+		assert.Equal(t, StateCritical, n.State)
+		assert.True(t, strings.HasPrefix(n.String(), "CRITICAL - room=23.4 outside of 22 |"), n.String())
+		assert.Contains(t, n.String(), "[CRITICAL] room=23.4 outside of 22")
+	})
+	t.Run("missing metric", func(t *testing.T) {
+		n := RenderNagios(s, r, NagiosMetric{Name: "nonexistent"})
+		assert.Equal(t, StateUnknown, n.State)
+		assert.Equal(t, 3, n.ExitCode())
+	})
+	t.Run("handler", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/nagios", nil)
+		require.NoError(t, err)
+		rr := httptest.NewRecorder()
+		HandleNagios(s, r, NagiosMetric{Name: "room"})(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "1", rr.Header().Get("X-Nagios-Exit-Code"))
+		assert.True(t, strings.HasPrefix(rr.Body.String(), "WARNING - "))
+	})
+}
+
+func TestNagiosResultRaise(t *testing.T) {
+	n := NagiosResult{State: StateOk, Message: "metrics ok"}
+	n.Raise(StateWarning, "queue=20 outside of 10")
+	assert.Equal(t, StateWarning, n.State)
+	assert.Equal(t, "queue=20 outside of 10", n.Message, "worse state names the cause")
+	n.Raise(StateWarning, "latency=3 outside of 2")
+	assert.Equal(t, "queue=20 outside of 10", n.Message, "same state keeps first cause")
+	n.Raise(StateCritical, "error fetching metrics")
+	assert.Equal(t, "error fetching metrics", n.Message)
+	n.Raise(StateUnknown, "no such metric: foo")
+	assert.Equal(t, StateCritical, n.State)
+	assert.Equal(t, "error fetching metrics", n.Message)
+	assert.Len(t, n.LongOutput, 4)
+}
+
+func TestNagiosCode(t *testing.T) {
+	assert.Equal(t, 0, StateOk.NagiosCode())
+	assert.Equal(t, 1, StateWarning.NagiosCode())
+	assert.Equal(t, 2, StateCritical.NagiosCode())
+	assert.Equal(t, 3, StateUnknown.NagiosCode())
+	assert.Equal(t, 3, StateInvalid.NagiosCode())
+}
@@ -0,0 +1,226 @@
+package mon
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Probe is bitmask of Kubernetes probes component affects
+type Probe uint8
+
+const (
+	ProbeLiveness = Probe(1 << iota)
+	ProbeReadiness
+	ProbeStartup
+)
+
+// DefaultProbes are probes affected by components that did not set their own (and did not inherit them from parent).
+// Liveness is not included as failing dependency should not get the app restarted
+const DefaultProbes = ProbeReadiness | ProbeStartup
+
+// SetProbes sets which probes component (and all its components that did not set their own) affects
+//
+//	worker.SetProbes(mon.ProbeLiveness | mon.ProbeReadiness)
+func (s *Status) SetProbes(p Probe) {
+	s.Lock()
+	s.probes = p
+	s.Unlock()
+}
+
+// String returns names of probes, separated by `|`
+func (p Probe) String() string {
+	var names []string
+	if p&ProbeLiveness != 0 {
+		names = append(names, "liveness")
+	}
+	if p&ProbeReadiness != 0 {
+		names = append(names, "readiness")
+	}
+	if p&ProbeStartup != 0 {
+		names = append(names, "startup")
+	}
+	return strings.Join(names, "|")
+}
+
+// Probes evaluates Kubernetes liveness, readiness and startup probes from the same Status tree
+type Probes struct {
+	status *Status
+	sync.Mutex
+	started        bool
+	notReady       bool
+	notReadyReason string
+}
+
+// ProbeResult is returned by probe handlers
+type ProbeResult struct {
+	Probe string `json:"probe"`
+	State State  `json:"state"`
+	Msg   string `json:"msg"`
+}
+
+// GlobalProbes evaluates probes of GlobalStatus
+var GlobalProbes *Probes
+
+// NewProbes creates probes for given status tree
+func NewProbes(s *Status) *Probes {
+	return &Probes{status: s}
+}
+
+// Liveness returns state of components affecting liveness. If there are none it is always Ok
+func (p *Probes) Liveness() (State, string) {
+	state, msg, ok := probeState(p.status, ProbeLiveness, DefaultProbes)
+	if !ok {
+		return StateOk, "alive"
+	}
+	return state, msg
+}
+
+// Readiness returns state of components affecting readiness, or Critical if app was marked as not ready via SetReady(false)
+func (p *Probes) Readiness() (State, string) {
+	p.Lock()
+	notReady, reason := p.notReady, p.notReadyReason
+	p.Unlock()
+	if notReady {
+		return StateCritical, reason
+	}
+	state, msg, ok := probeState(p.status, ProbeReadiness, DefaultProbes)
+	if !ok {
+		return StateOk, "ready"
+	}
+	return state, msg
+}
+
+// Startup stays Critical until every component affecting startup reported Ok at least once; after that it is always Ok
+func (p *Probes) Startup() (State, string) {
+	p.Lock()
+	defer p.Unlock()
+	if p.started {
+		return StateOk, "started"
+	}
+	var pending []string
+	walkProbe(p.status, nil, DefaultProbes, func(path []string, s *Status, probes Probe) {
+		if probes&ProbeStartup != 0 && !s.everOk {
+			pending = append(pending, strings.Join(path, "/"))
+		}
+	})
+	if len(pending) > 0 {
+		return StateCritical, "waiting for: " + strings.Join(pending, ", ")
+	}
+	p.started = true
+	return StateOk, "started"
+}
+
+// SetReady toggles readiness, for example to stop getting traffic before graceful shutdown.
+// When not ready readiness probe fails with given reason regardless of components' state
+func (p *Probes) SetReady(ready bool, reason ...string) {
+	p.Lock()
+	defer p.Unlock()
+	p.notReady = !ready
+	p.notReadyReason = "not ready"
+	if len(reason) > 0 && reason[0] != "" {
+		p.notReadyReason = reason[0]
+	}
+}
+
+// HandleLiveness returns liveness of GlobalStatus
+func HandleLiveness(w http.ResponseWriter, req *http.Request) {
+	GlobalProbes.HandleLiveness(w, req)
+}
+
+// HandleReadiness returns readiness of GlobalStatus
+func HandleReadiness(w http.ResponseWriter, req *http.Request) {
+	GlobalProbes.HandleReadiness(w, req)
+}
+
+// HandleStartup returns startup state of GlobalStatus
+func HandleStartup(w http.ResponseWriter, req *http.Request) {
+	GlobalProbes.HandleStartup(w, req)
+}
+
+// HandleLiveness returns liveness with HTTP code same as HandleHealthcheck (200 for Ok/Warning)
+func (p *Probes) HandleLiveness(w http.ResponseWriter, req *http.Request) {
+	state, msg := p.Liveness()
+	handleProbe(w, "liveness", state, msg)
+}
+
+// HandleReadiness returns readiness with HTTP code same as HandleHealthcheck (200 for Ok/Warning)
+func (p *Probes) HandleReadiness(w http.ResponseWriter, req *http.Request) {
+	state, msg := p.Readiness()
+	handleProbe(w, "readiness", state, msg)
+}
+
+// HandleStartup returns startup state with HTTP code same as HandleHealthcheck (200 for Ok/Warning)
+func (p *Probes) HandleStartup(w http.ResponseWriter, req *http.Request) {
+	state, msg := p.Startup()
+	handleProbe(w, "startup", state, msg)
+}
+
+func handleProbe(w http.ResponseWriter, probe string, state State, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	httpStatus := healthcheckHTTPStatus(state)
+	js, err := json.Marshal(ProbeResult{Probe: probe, State: state, Msg: msg})
+	if err != nil {
+		http.Error(w, err.Error(), httpStatus)
+		return
+	} else if httpStatus != http.StatusOK {
+		w.WriteHeader(httpStatus)
+	}
+	w.Write(js)
+}
+
+// probeState evaluates status tree for given probe. Components not affecting the probe are skipped
+// and parents' state policies are applied to the rest. ok is false if no component in the tree affects the probe
+func probeState(s *Status, probe Probe, inherited Probe) (state State, msg string, ok bool) {
+	s.RLock()
+	probes := s.probes
+	if probes == 0 {
+		probes = inherited
+	}
+	components := s.Components
+	summaryState, summaryMessage := s.summaryState, s.summaryMessage
+	state, msg = s.State, s.Msg
+	s.RUnlock()
+	if len(components) == 0 {
+		return state, msg, probes&probe != 0
+	}
+	filtered := make(map[string]*Status)
+	for name, c := range components {
+		cState, cMsg, ok := probeState(c, probe, probes)
+		if !ok {
+			continue
+		}
+		c.RLock()
+		filtered[name] = &Status{
+			Name:         c.Name,
+			State:        cState,
+			Msg:          cMsg,
+			Criticality:  c.Criticality,
+			Maintenance:  c.Maintenance,
+			Acknowledged: c.Acknowledged,
+		}
+		c.RUnlock()
+	}
+	if len(filtered) == 0 {
+		return StateOk, "", false
+	}
+	return summaryState(&filtered), summaryMessage(&filtered), true
+}
+
+// walkProbe calls f for each component without children, with probes it affects. Lock is held when f is called
+func walkProbe(s *Status, path []string, inherited Probe, f func(path []string, s *Status, probes Probe)) {
+	names, children := s.children()
+	s.RLock()
+	probes := s.probes
+	if probes == 0 {
+		probes = inherited
+	}
+	if len(children) == 0 {
+		f(path, s, probes)
+	}
+	s.RUnlock()
+	for i, c := range children {
+		walkProbe(c, append(append([]string{}, path...), names[i]), probes, f)
+	}
+}
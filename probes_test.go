@@ -0,0 +1,110 @@
+package mon
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProbes(t *testing.T) {
+	s := NewStatus("app")
+	worker := s.MustNewComponent("worker")
+	worker.SetProbes(ProbeLiveness | ProbeReadiness)
+	db := s.MustNewComponent("db")
+	migrations := s.MustNewComponent("migrations")
+	migrations.SetProbes(ProbeStartup)
+	cache := s.MustNewComponent("cache")
+	cache.SetStatePolicy(PolicyQuorum(1))
+	c1 := cache.MustNewComponent("c1")
+	c2 := cache.MustNewComponent("c2")
+	p := NewProbes(s)
+
+	state, msg := p.Startup()
+	assert.Equal(t, StateCritical, state)
+	assert.Equal(t, "waiting for: cache/c1, cache/c2, db, migrations", msg)
+	state, _ = p.Liveness()
+	assert.Equal(t, StateUnknown, state)
+
+	worker.MustUpdate(StateOk, "running")
+	db.MustUpdate(StateOk, "running")
+	c1.MustUpdate(StateOk, "running")
+	c2.MustUpdate(StateCritical, "down")
+	migrations.MustUpdate(StateCritical, "failed")
+
+	state, msg = p.Readiness()
+	assert.Equal(t, StateOk, state, "quorum policy is applied, migrations not included: %s", msg)
+	state, _ = p.Liveness()
+	assert.Equal(t, StateOk, state)
+	state, msg = p.Startup()
+	assert.Equal(t, StateCritical, state)
+	assert.Equal(t, "waiting for: cache/c2, migrations", msg)
+
+	c2.MustUpdate(StateOk, "running")
+	migrations.MustUpdate(StateOk, "done")
+	state, _ = p.Startup()
+	assert.Equal(t, StateOk, state)
+	migrations.MustUpdate(StateCritical, "failed")
+	state, _ = p.Startup()
+	assert.Equal(t, StateOk, state, "startup stays passed")
+
+	db.MustUpdate(StateCritical, "down")
+	state, msg = p.Readiness()
+	assert.Equal(t, StateCritical, state)
+	assert.Contains(t, msg, "[db]down")
+	assert.NotContains(t, msg, "migrations")
+	state, _ = p.Liveness()
+	assert.Equal(t, StateOk, state, "db does not affect liveness")
+
+	worker.MustUpdate(StateCritical, "deadlocked")
+	state, msg = p.Liveness()
+	assert.Equal(t, StateCritical, state)
+	assert.Equal(t, "C:[worker]deadlocked", msg)
+}
+
+func TestProbesReadinessToggle(t *testing.T) {
+	s := NewStatus("app")
+	s.MustUpdate(StateOk, "ok")
+	p := NewProbes(s)
+	state, _ := p.Readiness()
+	assert.Equal(t, StateOk, state)
+	p.SetReady(false, "shutting down")
+	state, msg := p.Readiness()
+	assert.Equal(t, StateCritical, state)
+	assert.Equal(t, "shutting down", msg)
+	p.SetReady(true)
+	state, _ = p.Readiness()
+	assert.Equal(t, StateOk, state)
+}
+
+func TestProbesNoLivenessComponents(t *testing.T) {
+	p := NewProbes(NewStatus("app"))
+	state, msg := p.Liveness()
+	assert.Equal(t, StateOk, state)
+	assert.Equal(t, "alive", msg)
+}
+
+func TestHandleProbes(t *testing.T) {
+	s := NewStatus("app")
+	p := NewProbes(s)
+	rr := httptest.NewRecorder()
+	p.HandleStartup(rr, httptest.NewRequest("GET", "/_status/startup", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	s.MustUpdate(StateWarning, "slow")
+	rr = httptest.NewRecorder()
+	p.HandleReadiness(rr, httptest.NewRequest("GET", "/_status/ready", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var result ProbeResult
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &result))
+	assert.Equal(t, ProbeResult{Probe: "readiness", State: StateWarning, Msg: "slow"}, result)
+	rr = httptest.NewRecorder()
+	HandleLiveness(rr, httptest.NewRequest("GET", "/_status/live", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestProbeString(t *testing.T) {
+	assert.Equal(t, "readiness|startup", DefaultProbes.String())
+}
@@ -1,6 +1,7 @@
 package mon
 
 import (
+	"encoding/json"
 	"fmt"
 	"runtime"
 	"sync"
@@ -27,7 +28,8 @@ func NewRegistry(fqdn string, instance string, interval float64) (*Registry, err
 
 func (r *Registry) GetMetric(name string, tags ...map[string]string) (Metric, error) {
 	gob := gobTag(mapToGobTag(tags...))
-
+	r.Lock()
+	defer r.Unlock()
 	if r, ok := r.Metrics[name]; ok {
 		if r, ok := r[string(gob)]; ok {
 			return r, nil
@@ -50,13 +52,46 @@ func (r *Registry) GetRegistry() *Registry {
 		Metrics:  make(map[string]map[string]Metric),
 	}
 	for k, v := range r.Metrics {
-		clone.Metrics[k] = v
+		series := make(map[string]Metric, len(v))
+		for gob, m := range v {
+			series[gob] = m
+		}
+		clone.Metrics[k] = series
 	}
 	clone.UpdateTs()
 	r.Unlock()
 	return &clone
 }
 
+// MarshalJSON renders registry with series of each metric keyed by their labels, in `key="value",...` format sorted by key.
+// Metric without labels has empty key
+func (r *Registry) MarshalJSON() ([]byte, error) {
+	r.Lock()
+	metrics := make(map[string]map[string]Metric, len(r.Metrics))
+	for name, series := range r.Metrics {
+		m := make(map[string]Metric, len(series))
+		for gob, metric := range series {
+			m[gobTagLabels(gob)] = metric
+		}
+		metrics[name] = m
+	}
+	out := struct {
+		Metrics  map[string]map[string]Metric `json:"metrics"`
+		Instance string                       `json:"instance"`
+		Interval float64                      `json:"interval"`
+		FQDN     string                       `json:"fqdn"`
+		Ts       time.Time                    `json:"ts,omitempty"`
+	}{
+		Metrics:  metrics,
+		Instance: r.Instance,
+		Interval: r.Interval,
+		FQDN:     r.FQDN,
+		Ts:       r.Ts,
+	}
+	r.Unlock()
+	return json.Marshal(out)
+}
+
 // Set instance name returned by registry during marshalling
 func (r *Registry) SetInstance(name string) {
 	r.Lock()
@@ -126,6 +161,21 @@ func (r *Registry) RegisterOrGet(name string, metric Metric, tags ...map[string]
 	return metric, nil
 }
 
+// Unregister() removes metric with given name and tags, returns false if there was no such metric
+func (r *Registry) Unregister(name string, tags ...map[string]string) bool {
+	gob := gobTag(mapToGobTag(tags...))
+	r.Lock()
+	defer r.Unlock()
+	if _, ok := r.Metrics[name][string(gob)]; !ok {
+		return false
+	}
+	delete(r.Metrics[name], string(gob))
+	if len(r.Metrics[name]) == 0 {
+		delete(r.Metrics, name)
+	}
+	return true
+}
+
 // MustRegister() does same as Register() except it panic()s if metric already exists.
 // It is mostly intended to be used for top of the package, package-scoped metrics like
 //
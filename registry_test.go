@@ -28,6 +28,24 @@ func TestRegistry(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestRegistryLabelsSameSeries(t *testing.T) {
+	r, err := NewRegistry("", "", 10)
+	assert.NoError(t, err)
+	labels := func() map[string]string {
+		return map[string]string{"lb_node": "lb1", "backend": "bck", "server": "srv1", "dc": "dc1", "env": "prod"}
+	}
+	m := r.MustRegister("requests", NewGauge(), labels())
+	for i := 0; i < 50; i++ {
+		same, err := r.RegisterOrGet("requests", NewGauge(), labels())
+		assert.NoError(t, err)
+		assert.True(t, m == same, "same labels resolve to same series")
+		got, err := r.GetMetric("requests", labels())
+		assert.NoError(t, err)
+		assert.True(t, m == got)
+	}
+	assert.Len(t, r.Metrics["requests"], 1)
+}
+
 func BenchmarkRegistry_GetRegistry(b *testing.B) {
 	for n := 0; n < b.N; n++ {
 		GlobalRegistry.GetRegistry()
@@ -50,3 +68,33 @@ func BenchmarkGobtag(b *testing.B) {
 		gobTag(v)
 	}
 }
+
+func TestRegistryUnregister(t *testing.T) {
+	r, err := NewRegistry("", "", 10)
+	assert.NoError(t, err)
+	r.MustRegister("requests", NewGauge(), map[string]string{"node": "a"})
+	r.MustRegister("requests", NewGauge(), map[string]string{"node": "b"})
+	assert.True(t, r.Unregister("requests", map[string]string{"node": "a"}))
+	assert.False(t, r.Unregister("requests", map[string]string{"node": "a"}))
+	_, err = r.GetMetric("requests", map[string]string{"node": "b"})
+	assert.NoError(t, err)
+	assert.True(t, r.Unregister("requests", map[string]string{"node": "b"}))
+	assert.NotContains(t, r.Metrics, "requests")
+}
+
+func TestRegistryMarshalJSON(t *testing.T) {
+	r, err := NewRegistry("host.example.com", "app", 10)
+	assert.NoError(t, err)
+	r.MustRegister("queue", NewGauge()).Update(1)
+	r.MustRegister("queue", NewGauge(), map[string]string{"lb_node": "lb1", "backend": `b"k`}).Update(2)
+	js, err := json.Marshal(r)
+	assert.NoError(t, err)
+	var out struct {
+		Metrics  map[string]map[string]JSONOut `json:"metrics"`
+		Instance string                        `json:"instance"`
+	}
+	assert.NoError(t, json.Unmarshal(js, &out))
+	assert.Equal(t, "app", out.Instance)
+	assert.Equal(t, 1.0, out.Metrics["queue"][""].Value)
+	assert.Equal(t, 2.0, out.Metrics["queue"][`backend="b\"k",lb_node="lb1"`].Value)
+}
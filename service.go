@@ -0,0 +1,53 @@
+package mon
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// ToService converts status tree to Service format. Host defaults to FQDN of the status
+func (s *Status) ToService(host ...string) Service {
+	h := s.FQDN
+	if len(host) > 0 && host[0] != "" {
+		h = host[0]
+	}
+	return s.toService(h)
+}
+
+func (s *Status) toService(host string) Service {
+	state := s.GetState()
+	s.RLock()
+	svc := Service{
+		Host:          host,
+		Service:       s.Name,
+		State:         uint8(state),
+		Timestamp:     s.Ts,
+		StateDuration: time.Since(s.stateTs),
+	}
+	s.RUnlock()
+	_, children := s.children()
+	for _, c := range children {
+		svc.Components = append(svc.Components, c.toService(host))
+	}
+	return svc
+}
+
+// HandleService returns GlobalStatus in Service format with appropriate HTTP code
+func HandleService(w http.ResponseWriter, req *http.Request) {
+	handleService(w, req, GlobalStatus)
+}
+
+func handleService(w http.ResponseWriter, req *http.Request, s *Status) {
+	w.Header().Set("Content-Type", "application/json")
+	svc := s.ToService()
+	httpStatus := healthcheckHTTPStatus(State(svc.State))
+	js, err := json.Marshal(svc)
+	if err != nil {
+		http.Error(w, err.Error(), httpStatus)
+		return
+	} else if httpStatus != http.StatusOK {
+		w.WriteHeader(httpStatus)
+	}
+	w.Write(js)
+}
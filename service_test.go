@@ -0,0 +1,58 @@
+package mon
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToService(t *testing.T) {
+	s := NewStatus("app")
+	s.FQDN = "app.example.com"
+	db := s.MustNewComponent("db")
+	web := s.MustNewComponent("web")
+	app1 := web.MustNewComponent("app1")
+	require.NoError(t, db.Update(StateOk, "running"))
+	require.NoError(t, app1.Update(StateOk, "running"))
+	time.Sleep(time.Millisecond * 20)
+	require.NoError(t, db.Update(StateOk, "still running"))
+	require.NoError(t, app1.Update(StateCritical, "down"))
+	time.Sleep(time.Millisecond)
+
+	svc := s.ToService()
+	assert.Equal(t, "app.example.com", svc.Host)
+	assert.Equal(t, "app", svc.Service)
+	assert.Equal(t, uint8(StateCritical), svc.State)
+	require.Len(t, svc.Components, 2)
+	assert.Equal(t, "db", svc.Components[0].Service)
+	assert.Equal(t, "app.example.com", svc.Components[0].Host)
+	assert.GreaterOrEqual(t, svc.Components[0].StateDuration, time.Millisecond*20, "no state change on update with same state")
+	assert.Less(t, svc.Components[1].Components[0].StateDuration, time.Millisecond*20, "state changed")
+	assert.Equal(t, "app1", svc.Components[1].Components[0].Service)
+
+	assert.Equal(t, "other.example.com", s.ToService("other.example.com").Components[1].Components[0].Host)
+}
+
+func TestServiceHandler(t *testing.T) {
+	s := NewStatus("app")
+	require.NoError(t, s.Update(StateWarning, "degraded"))
+	req, err := http.NewRequest("GET", "/service", nil)
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	handleService(rr, req, s)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var svc Service
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &svc))
+	assert.Equal(t, uint8(StateWarning), svc.State)
+	assert.Equal(t, "app", svc.Service)
+
+	require.NoError(t, s.Update(StateCritical, "down"))
+	rr = httptest.NewRecorder()
+	handleService(rr, req, s)
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+}
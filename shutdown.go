@@ -0,0 +1,272 @@
+package mon
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// ShutdownPhase is current phase of graceful shutdown
+type ShutdownPhase int
+
+const (
+	// ShutdownRunning - shutdown was not started yet
+	ShutdownRunning = ShutdownPhase(iota)
+	// ShutdownDraining - waiting for load balancer to mark us down
+	ShutdownDraining
+	// ShutdownWaitingRequests - waiting for in-flight requests to finish
+	ShutdownWaitingRequests
+	// ShutdownStopping - http.Server.Shutdown() was called
+	ShutdownStopping
+	// ShutdownDone - server is stopped
+	ShutdownDone
+)
+
+// String returns name of the phase
+func (p ShutdownPhase) String() string {
+	switch p {
+	case ShutdownRunning:
+		return "running"
+	case ShutdownDraining:
+		return "draining"
+	case ShutdownWaitingRequests:
+		return "waiting for requests"
+	case ShutdownStopping:
+		return "stopping"
+	case ShutdownDone:
+		return "done"
+	}
+	return fmt.Sprintf("unknown(%d)", int(p))
+}
+
+// ShutdownConfig configures graceful shutdown
+type ShutdownConfig struct {
+	// Server to shut down (required)
+	Server *http.Server
+	// Status to change on shutdown, defaults to GlobalStatus. If it has components, `shutdown` component is created and updated instead
+	Status *Status
+	// State set on shutdown, defaults to Warning which makes HandleHealthchecksHaproxy(true) return 404 (NOLB).
+	// Use Critical with plain HandleHealthcheck
+	State State
+	// Message set on shutdown, defaults to "shutting down"
+	Message string
+	// State of haproxy, as returned by HandleHealthchecksHaproxy(). If haproxy's header was seen, shutdown waits until SafeToStop() is true
+	Haproxy *HaproxyState
+	// Probes to mark as not ready on shutdown, optional
+	Probes *Probes
+	// Time to wait for load balancer to notice we are down, when there is no haproxy state to check. Defaults to 10s
+	MinDrainTime time.Duration
+	// Maximum time to wait for load balancer and in-flight requests, defaults to 30s
+	DrainTimeout time.Duration
+	// Deadline for http.Server.Shutdown(), defaults to 10s
+	ShutdownTimeout time.Duration
+	// Signals triggering shutdown in Run(), default SIGTERM and SIGINT
+	Signals []os.Signal
+	// Registry to expose progress in as `shutdown.phase`, `shutdown.in_flight` and `shutdown.elapsed` gauges,
+	// updated while shutdown is in progress. Optional
+	Registry *Registry
+}
+
+// GracefulShutdown drains the app from load balancer before shutting down HTTP server
+type GracefulShutdown struct {
+	// accessed atomically, first so they are aligned on 32 bit platforms
+	inFlight int64
+	phase    int64
+	cfg      ShutdownConfig
+	once     sync.Once
+	err      error
+	started  time.Time
+
+	phaseMetric    Metric
+	inFlightMetric Metric
+	elapsedMetric  Metric
+}
+
+// NewGracefulShutdown creates shutdown orchestrator. Wrap the server's handler with Middleware() so in-flight requests are counted
+//
+//	shutdown, err := mon.NewGracefulShutdown(mon.ShutdownConfig{Server: srv, Haproxy: haproxyState})
+//	srv.Handler = shutdown.Middleware(mux)
+//	go srv.ListenAndServe()
+//	err = shutdown.Run(context.Background())
+func NewGracefulShutdown(cfg ShutdownConfig) (*GracefulShutdown, error) {
+	if cfg.Server == nil {
+		return nil, fmt.Errorf("http server is required")
+	}
+	if cfg.Status == nil {
+		cfg.Status = GlobalStatus
+	}
+	if cfg.State == StateInvalid {
+		cfg.State = StateWarning
+	}
+	if cfg.Message == "" {
+		cfg.Message = "shutting down"
+	}
+	if cfg.MinDrainTime <= 0 {
+		cfg.MinDrainTime = time.Second * 10
+	}
+	if cfg.DrainTimeout <= 0 {
+		cfg.DrainTimeout = time.Second * 30
+	}
+	if cfg.ShutdownTimeout <= 0 {
+		cfg.ShutdownTimeout = time.Second * 10
+	}
+	if len(cfg.Signals) == 0 {
+		cfg.Signals = []os.Signal{syscall.SIGTERM, os.Interrupt}
+	}
+	g := &GracefulShutdown{cfg: cfg}
+	if cfg.Registry != nil {
+		var err error
+		if g.phaseMetric, err = cfg.Registry.RegisterOrGet("shutdown.phase", NewGauge()); err != nil {
+			return nil, err
+		}
+		if g.inFlightMetric, err = cfg.Registry.RegisterOrGet("shutdown.in_flight", NewGauge("requests")); err != nil {
+			return nil, err
+		}
+		if g.elapsedMetric, err = cfg.Registry.RegisterOrGet("shutdown.elapsed", NewGauge("seconds")); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// Middleware counts in-flight requests
+func (g *GracefulShutdown) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt64(&g.inFlight, 1)
+		defer atomic.AddInt64(&g.inFlight, -1)
+		next.ServeHTTP(w, req)
+	})
+}
+
+// InFlight returns number of requests in progress
+func (g *GracefulShutdown) InFlight() int64 {
+	return atomic.LoadInt64(&g.inFlight)
+}
+
+// Phase returns current phase of the shutdown
+func (g *GracefulShutdown) Phase() ShutdownPhase {
+	return ShutdownPhase(atomic.LoadInt64(&g.phase))
+}
+
+// Run waits for one of configured signals (or context cancellation) and then shuts down gracefully.
+// Once it started, another signal skips waiting for load balancer and in-flight requests, like cancelling context of Shutdown() does.
+// If shutdown was started by a signal, cancelling ctx does that too
+func (g *GracefulShutdown) Run(ctx context.Context) error {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, g.cfg.Signals...)
+	defer signal.Stop(sig)
+	parent := ctx
+	select {
+	case <-sig:
+	case <-ctx.Done():
+		parent = context.Background()
+	}
+	shutdownCtx, cancel := context.WithCancel(parent)
+	defer cancel()
+	go func() {
+		select {
+		case <-sig:
+			cancel()
+		case <-shutdownCtx.Done():
+		}
+	}()
+	return g.Shutdown(shutdownCtx)
+}
+
+// Shutdown changes status to shutting down, waits for load balancer to stop sending traffic
+// and for in-flight requests to finish, then shuts down HTTP server.
+// Cancelling context skips waiting. Calling it more than once returns result of the first call
+func (g *GracefulShutdown) Shutdown(ctx context.Context) error {
+	g.once.Do(func() {
+		g.err = g.shutdown(ctx)
+	})
+	return g.err
+}
+
+func (g *GracefulShutdown) shutdown(ctx context.Context) error {
+	g.started = time.Now()
+	g.setPhase(ShutdownDraining)
+	if err := g.updateStatus(); err != nil {
+		return err
+	}
+	if g.cfg.Probes != nil {
+		g.cfg.Probes.SetReady(false, g.cfg.Message)
+	}
+	drainCtx, cancel := context.WithTimeout(ctx, g.cfg.DrainTimeout)
+	defer cancel()
+
+	if g.cfg.Haproxy != nil && g.haproxySeen() {
+		g.waitFor(drainCtx, g.cfg.Haproxy.SafeToStop)
+	} else {
+		t := time.NewTimer(g.cfg.MinDrainTime)
+		select {
+		case <-t.C:
+		case <-drainCtx.Done():
+			t.Stop()
+		}
+	}
+
+	g.setPhase(ShutdownWaitingRequests)
+	g.waitFor(drainCtx, func() bool { return g.InFlight() == 0 })
+
+	g.setPhase(ShutdownStopping)
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), g.cfg.ShutdownTimeout)
+	defer shutdownCancel()
+	err := g.cfg.Server.Shutdown(shutdownCtx)
+	g.setPhase(ShutdownDone)
+	return err
+}
+
+func (g *GracefulShutdown) updateStatus() error {
+	s := g.cfg.Status
+	s.RLock()
+	hasComponents := len(s.Components) > 0
+	s.RUnlock()
+	if hasComponents {
+		s = s.GetOrCreateComponent("shutdown")
+	}
+	return s.Update(g.cfg.State, g.cfg.Message)
+}
+
+func (g *GracefulShutdown) haproxySeen() bool {
+	g.cfg.Haproxy.RLock()
+	defer g.cfg.Haproxy.RUnlock()
+	return g.cfg.Haproxy.Found
+}
+
+// waitFor polls f until it returns true or context is done
+func (g *GracefulShutdown) waitFor(ctx context.Context, f func() bool) {
+	t := time.NewTicker(time.Millisecond * 100)
+	defer t.Stop()
+	for !f() {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			g.updateProgress()
+		}
+	}
+}
+
+func (g *GracefulShutdown) setPhase(p ShutdownPhase) {
+	atomic.StoreInt64(&g.phase, int64(p))
+	if g.phaseMetric != nil {
+		g.phaseMetric.Update(float64(p))
+	}
+	g.updateProgress()
+}
+
+func (g *GracefulShutdown) updateProgress() {
+	if g.elapsedMetric != nil {
+		g.elapsedMetric.Update(time.Since(g.started).Seconds())
+	}
+	if g.inFlightMetric != nil {
+		g.inFlightMetric.Update(float64(g.InFlight()))
+	}
+}
@@ -0,0 +1,174 @@
+package mon
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testShutdownServer(t *testing.T, handler http.Handler) (*http.Server, string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := &http.Server{Handler: handler}
+	go srv.Serve(l)
+	return srv, "http://" + l.Addr().String()
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	s := NewStatus("app")
+	s.MustNewComponent("db").MustUpdate(StateOk, "ok")
+	r, err := NewRegistry("", "", 10)
+	require.NoError(t, err)
+	probes := NewProbes(s)
+	release := make(chan bool)
+	started := make(chan bool)
+	srv, url := testShutdownServer(t, nil)
+	g, err := NewGracefulShutdown(ShutdownConfig{
+		Server:       srv,
+		Status:       s,
+		Probes:       probes,
+		MinDrainTime: time.Millisecond * 50,
+		Registry:     r,
+	})
+	require.NoError(t, err)
+	srv.Handler = g.Middleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		close(started)
+		<-release
+	}))
+	assert.Equal(t, ShutdownRunning, g.Phase())
+
+	reqDone := make(chan error)
+	go func() {
+		resp, err := http.Get(url)
+		if err == nil {
+			resp.Body.Close()
+		}
+		reqDone <- err
+	}()
+	<-started
+	assert.Equal(t, int64(1), g.InFlight())
+
+	done := make(chan error)
+	go func() { done <- g.Shutdown(context.Background()) }()
+	assert.Eventually(t, func() bool { return g.Phase() == ShutdownWaitingRequests }, time.Second, time.Millisecond)
+	shutdown, ok := s.GetComponent("shutdown")
+	require.True(t, ok)
+	assert.Equal(t, StateWarning, shutdown.GetState())
+	assert.Equal(t, "shutting down", shutdown.GetMessage())
+	state, _ := probes.Readiness()
+	assert.Equal(t, StateCritical, state)
+	time.Sleep(time.Millisecond * 150)
+	assert.Equal(t, ShutdownWaitingRequests, g.Phase(), "waits for in-flight requests")
+	inFlight, err := r.GetMetric("shutdown.in_flight")
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, inFlight.Value())
+
+	close(release)
+	require.NoError(t, <-reqDone)
+	require.NoError(t, <-done)
+	assert.Equal(t, ShutdownDone, g.Phase())
+	assert.Equal(t, int64(0), g.InFlight())
+	phase, err := r.GetMetric("shutdown.phase")
+	require.NoError(t, err)
+	assert.Equal(t, float64(ShutdownDone), phase.Value())
+	_, err = http.Get(url)
+	assert.Error(t, err, "server is stopped")
+	assert.NoError(t, g.Shutdown(context.Background()), "second call returns first result")
+}
+
+func TestGracefulShutdownHaproxy(t *testing.T) {
+	s := NewStatus("app")
+	srv, _ := testShutdownServer(t, http.NotFoundHandler())
+	haproxy := &HaproxyState{State: StateOk, Found: true, ServerCurrentConnections: 3}
+	g, err := NewGracefulShutdown(ShutdownConfig{
+		Server:       srv,
+		Status:       s,
+		State:        StateCritical,
+		Haproxy:      haproxy,
+		MinDrainTime: time.Hour,
+	})
+	require.NoError(t, err)
+	done := make(chan error)
+	go func() { done <- g.Shutdown(context.Background()) }()
+	assert.Eventually(t, func() bool { return s.GetState() == StateCritical }, time.Second, time.Millisecond, "status without components is updated directly")
+	time.Sleep(time.Millisecond * 150)
+	assert.Equal(t, ShutdownDraining, g.Phase(), "waits for haproxy")
+	haproxy.update(&HaproxyState{State: StateWarning, Found: true, TS: time.Now()})
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second * 2):
+		t.Fatal("shutdown did not finish after haproxy marked server down")
+	}
+}
+
+func TestGracefulShutdownTimeout(t *testing.T) {
+	srv, _ := testShutdownServer(t, http.NotFoundHandler())
+	g, err := NewGracefulShutdown(ShutdownConfig{
+		Server:       srv,
+		Status:       NewStatus("app"),
+		MinDrainTime: time.Hour,
+		DrainTimeout: time.Millisecond * 50,
+	})
+	require.NoError(t, err)
+	start := time.Now()
+	require.NoError(t, g.Shutdown(context.Background()))
+	assert.Less(t, time.Since(start), time.Second)
+
+	_, err = NewGracefulShutdown(ShutdownConfig{})
+	assert.Error(t, err)
+}
+
+func TestGracefulShutdownRun(t *testing.T) {
+	self, err := os.FindProcess(os.Getpid())
+	require.NoError(t, err)
+	// so signal sent before Run() subscribes does not kill the test
+	ignore := make(chan os.Signal, 10)
+	signal.Notify(ignore, os.Interrupt)
+	defer signal.Stop(ignore)
+	for _, tc := range []struct {
+		name  string
+		start func(cancel func()) error
+		stop  func(cancel func()) error
+	}{
+		{"signal, then cancel", func(func()) error { return self.Signal(os.Interrupt) }, func(cancel func()) error { cancel(); return nil }},
+		{"cancel, then signal", func(cancel func()) error { cancel(); return nil }, func(func()) error { return self.Signal(os.Interrupt) }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv, _ := testShutdownServer(t, http.NotFoundHandler())
+			g, err := NewGracefulShutdown(ShutdownConfig{
+				Server:       srv,
+				Status:       NewStatus("app"),
+				MinDrainTime: time.Hour,
+				DrainTimeout: time.Hour,
+				Signals:      []os.Signal{os.Interrupt},
+			})
+			require.NoError(t, err)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			done := make(chan error)
+			go func() { done <- g.Run(ctx) }()
+			// wait for Run() to subscribe to signals
+			time.Sleep(time.Millisecond * 50)
+			if err := tc.start(cancel); err != nil {
+				t.Skipf("can't send signal: %s", err)
+			}
+			assert.Eventually(t, func() bool { return g.Phase() == ShutdownDraining }, time.Second, time.Millisecond)
+			require.NoError(t, tc.stop(cancel))
+			select {
+			case err := <-done:
+				assert.NoError(t, err)
+				assert.Equal(t, ShutdownDone, g.Phase())
+			case <-time.After(time.Second):
+				t.Fatal("draining not cut short")
+			}
+		})
+	}
+}
@@ -0,0 +1,295 @@
+package mon
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StatsdTimerBuckets are default histogram buckets (in milliseconds) used for metrics created from statsd timers
+var StatsdTimerBuckets = []float64{1, 2.5, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// StatsdServerConfig configures embedded statsd listener
+type StatsdServerConfig struct {
+	// UDP address to listen on, like "127.0.0.1:8125". Empty disables UDP listener
+	UDPAddress string
+	// TCP address to listen on. Empty disables TCP listener
+	TCPAddress string
+	// Buckets used for histograms created from `|h` and `|d` metrics, defaults to DefaultHistogramBuckets
+	HistogramBuckets []float64
+	// Buckets used for histograms created from `|ms` metrics, defaults to StatsdTimerBuckets
+	TimerBuckets []float64
+	// Called for every line that could not be parsed or applied
+	OnError func(line string, err error)
+}
+
+// StatsdServer receives statsd/DogStatsD lines and updates metrics in the Registry.
+// Metrics are created on first use:
+//
+// * `|c` as counter
+// * `|g` as gauge, with support for relative `+N`/`-N` updates
+// * `|ms`, `|h` and `|d` as histogram, with sampled (`|@0.1`) values counted 1/rate times
+//
+// DogStatsD tags are converted to metric labels
+type StatsdServer struct {
+	cfg      StatsdServerConfig
+	registry *Registry
+	udp      net.PacketConn
+	tcp      net.Listener
+	// serializes relative gauge updates
+	gaugeLock sync.Mutex
+}
+
+// NewStatsdServer creates statsd server and binds configured listeners; call Run() to start processing
+func NewStatsdServer(registry *Registry, cfg StatsdServerConfig) (*StatsdServer, error) {
+	if cfg.UDPAddress == "" && cfg.TCPAddress == "" {
+		return nil, fmt.Errorf("statsd server needs at least one of UDP or TCP address")
+	}
+	if len(cfg.HistogramBuckets) == 0 {
+		cfg.HistogramBuckets = DefaultHistogramBuckets
+	}
+	if len(cfg.TimerBuckets) == 0 {
+		cfg.TimerBuckets = StatsdTimerBuckets
+	}
+	s := &StatsdServer{
+		cfg:      cfg,
+		registry: registry,
+	}
+	var err error
+	if cfg.UDPAddress != "" {
+		s.udp, err = net.ListenPacket("udp", cfg.UDPAddress)
+		if err != nil {
+			return nil, fmt.Errorf("error listening on udp %s: %w", cfg.UDPAddress, err)
+		}
+	}
+	if cfg.TCPAddress != "" {
+		s.tcp, err = net.Listen("tcp", cfg.TCPAddress)
+		if err != nil {
+			if s.udp != nil {
+				s.udp.Close()
+			}
+			return nil, fmt.Errorf("error listening on tcp %s: %w", cfg.TCPAddress, err)
+		}
+	}
+	return s, nil
+}
+
+// UDPAddr returns address UDP listener is bound to or nil if it is disabled
+func (s *StatsdServer) UDPAddr() net.Addr {
+	if s.udp == nil {
+		return nil
+	}
+	return s.udp.LocalAddr()
+}
+
+// TCPAddr returns address TCP listener is bound to or nil if it is disabled
+func (s *StatsdServer) TCPAddr() net.Addr {
+	if s.tcp == nil {
+		return nil
+	}
+	return s.tcp.Addr()
+}
+
+// Run processes incoming metrics until context is cancelled, then closes listeners
+func (s *StatsdServer) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	if s.udp != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.serveUDP()
+		}()
+	}
+	if s.tcp != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.serveTCP(ctx)
+		}()
+	}
+	<-ctx.Done()
+	if s.udp != nil {
+		s.udp.Close()
+	}
+	if s.tcp != nil {
+		s.tcp.Close()
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+func (s *StatsdServer) serveUDP() {
+	buf := make([]byte, 65536)
+	for {
+		n, _, err := s.udp.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			s.handle(line)
+		}
+	}
+}
+
+func (s *StatsdServer) serveTCP(ctx context.Context) {
+	var tempDelay time.Duration
+	for {
+		conn, err := s.tcp.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) || ctx.Err() != nil {
+				return
+			}
+			tempDelay = acceptBackoff(tempDelay)
+			select {
+			case <-time.After(tempDelay):
+			case <-ctx.Done():
+			}
+			continue
+		}
+		tempDelay = 0
+		go func() {
+			done := make(chan struct{})
+			defer close(done)
+			go func() {
+				select {
+				case <-ctx.Done():
+					conn.Close()
+				case <-done:
+				}
+			}()
+			defer conn.Close()
+			scanner := bufio.NewScanner(conn)
+			for scanner.Scan() {
+				s.handle(scanner.Text())
+			}
+		}()
+	}
+}
+
+func (s *StatsdServer) handle(line string) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return
+	}
+	if err := s.HandleLine(line); err != nil && s.cfg.OnError != nil {
+		s.cfg.OnError(line, err)
+	}
+}
+
+// HandleLine parses single statsd line and applies it to the registry
+func (s *StatsdServer) HandleLine(line string) error {
+	m, err := parseStatsdLine(line)
+	if err != nil {
+		return err
+	}
+	switch m.kind {
+	case "c":
+		metric, err := s.registry.RegisterOrGet(m.name, NewCounter(), m.tags)
+		if err != nil {
+			return err
+		}
+		metric.Update(m.value / m.rate)
+	case "g":
+		metric, err := s.registry.RegisterOrGet(m.name, NewGauge(), m.tags)
+		if err != nil {
+			return err
+		}
+		if m.relative {
+			s.gaugeLock.Lock()
+			metric.Update(metric.Value() + m.value)
+			s.gaugeLock.Unlock()
+		} else {
+			metric.Update(m.value)
+		}
+	case "ms":
+		metric, err := s.registry.RegisterOrGet(m.name, NewHistogram(s.cfg.TimerBuckets, "ms"), m.tags)
+		if err != nil {
+			return err
+		}
+		observeSampled(metric, m)
+	case "h", "d":
+		metric, err := s.registry.RegisterOrGet(m.name, NewHistogram(s.cfg.HistogramBuckets), m.tags)
+		if err != nil {
+			return err
+		}
+		observeSampled(metric, m)
+	default:
+		return fmt.Errorf("unsupported statsd metric type [%s]", m.kind)
+	}
+	return nil
+}
+
+// observeSampled adds value to histogram 1/rate times (rounded), as client sent only that fraction of observations
+func observeSampled(metric Metric, m statsdMetric) {
+	if h, ok := metric.(*MetricHistogram); ok {
+		h.updateN(m.value, uint64(math.Round(1/m.rate)))
+		return
+	}
+	metric.Update(m.value)
+}
+
+type statsdMetric struct {
+	name     string
+	value    float64
+	relative bool
+	kind     string
+	rate     float64
+	tags     map[string]string
+}
+
+// parseStatsdLine parses `name:value|type[|@rate][|#tag:value,tag2]`
+func parseStatsdLine(line string) (m statsdMetric, err error) {
+	nameEnd := strings.LastIndex(strings.SplitN(line, "|", 2)[0], ":")
+	if nameEnd < 1 {
+		return m, fmt.Errorf("no metric name in [%s]", line)
+	}
+	m.name = line[:nameEnd]
+	parts := strings.Split(line[nameEnd+1:], "|")
+	if len(parts) < 2 {
+		return m, fmt.Errorf("no metric type in [%s]", line)
+	}
+	value := parts[0]
+	m.kind = parts[1]
+	m.rate = 1
+	if m.kind == "g" && (strings.HasPrefix(value, "+") || strings.HasPrefix(value, "-")) {
+		m.relative = true
+	}
+	m.value, err = strconv.ParseFloat(value, 64)
+	if err != nil {
+		return m, fmt.Errorf("bad value in [%s]: %w", line, err)
+	}
+	for _, p := range parts[2:] {
+		switch {
+		case strings.HasPrefix(p, "@"):
+			m.rate, err = strconv.ParseFloat(p[1:], 64)
+			if err != nil || m.rate <= 0 || m.rate > 1 {
+				return m, fmt.Errorf("bad sample rate in [%s]", line)
+			}
+		case strings.HasPrefix(p, "#"):
+			m.tags = make(map[string]string)
+			for _, tag := range strings.Split(p[1:], ",") {
+				if tag == "" {
+					continue
+				}
+				kv := strings.SplitN(tag, ":", 2)
+				if len(kv) == 2 {
+					m.tags[kv[0]] = kv[1]
+				} else {
+					m.tags[kv[0]] = ""
+				}
+			}
+		}
+		// other extensions (container id, timestamp) are ignored
+	}
+	return m, nil
+}
@@ -0,0 +1,127 @@
+package mon
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStatsdLine(t *testing.T) {
+	m, err := parseStatsdLine("web.requests:10|c|@0.5|#env:prod,canary")
+	require.NoError(t, err)
+	assert.Equal(t, "web.requests", m.name)
+	assert.Equal(t, 10.0, m.value)
+	assert.Equal(t, "c", m.kind)
+	assert.Equal(t, 0.5, m.rate)
+	assert.Equal(t, map[string]string{"env": "prod", "canary": ""}, m.tags)
+
+	m, err = parseStatsdLine("queue:-3|g")
+	require.NoError(t, err)
+	assert.True(t, m.relative)
+	assert.Equal(t, -3.0, m.value)
+
+	for _, bad := range []string{"novalue", ":1|c", "name:1", "name:abc|c", "name:1|c|@2"} {
+		_, err = parseStatsdLine(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestStatsdServer(t *testing.T) {
+	r, err := NewRegistry("", "", 10)
+	require.NoError(t, err)
+	var errs []string
+	var errsLock sync.Mutex
+	s, err := NewStatsdServer(r, StatsdServerConfig{
+		UDPAddress: "127.0.0.1:0",
+		TCPAddress: "127.0.0.1:0",
+		OnError: func(line string, err error) {
+			errsLock.Lock()
+			errs = append(errs, line)
+			errsLock.Unlock()
+		},
+	})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Run(ctx) }()
+
+	udp, err := net.Dial("udp", s.UDPAddr().String())
+	require.NoError(t, err)
+	defer udp.Close()
+	_, err = fmt.Fprint(udp, "requests:10|c|@0.5|#env:prod\ntemp:20|g\ntemp:+2|g\nlatency:5|ms\nlatency:15|ms\nbad line")
+	require.NoError(t, err)
+
+	tcp, err := net.Dial("tcp", s.TCPAddr().String())
+	require.NoError(t, err)
+	_, err = fmt.Fprint(tcp, "size:100|h\nsize:300|h\n")
+	require.NoError(t, err)
+	tcp.Close()
+
+	assert.Eventually(t, func() bool {
+		m, err := r.GetMetric("size")
+		return err == nil && m.(Histogram).HistogramSnapshot().Count == 2
+	}, time.Second, time.Millisecond*10)
+	assert.Eventually(t, func() bool {
+		m, err := r.GetMetric("latency")
+		return err == nil && m.(Histogram).HistogramSnapshot().Count == 2
+	}, time.Second, time.Millisecond*10)
+
+	requests, err := r.GetMetric("requests", map[string]string{"env": "prod"})
+	require.NoError(t, err)
+	assert.Equal(t, MetricTypeCounterFloat, requests.Type())
+	assert.Equal(t, 20.0, requests.Value(), "sample rate applied")
+	temp, err := r.GetMetric("temp")
+	require.NoError(t, err)
+	assert.Equal(t, 22.0, temp.Value(), "relative gauge update")
+	latency, err := r.GetMetric("latency")
+	require.NoError(t, err)
+	assert.Equal(t, "ms", latency.Unit())
+	assert.Equal(t, 10.0, latency.Value())
+	assert.Eventually(t, func() bool {
+		errsLock.Lock()
+		defer errsLock.Unlock()
+		return len(errs) == 1 && errs[0] == "bad line"
+	}, time.Second, time.Millisecond*10)
+
+	t.Run("sampled histogram", func(t *testing.T) {
+		require.NoError(t, s.HandleLine("sampled:20|ms|@0.25"))
+		require.NoError(t, s.HandleLine("sampled:40|ms"))
+		m, err := r.GetMetric("sampled")
+		require.NoError(t, err)
+		snap := m.(Histogram).HistogramSnapshot()
+		assert.Equal(t, uint64(5), snap.Count, "sampled value counted 1/rate times")
+		assert.Equal(t, 120.0, snap.Sum)
+		assert.Equal(t, 24.0, m.Value())
+	})
+
+	t.Run("type mismatch", func(t *testing.T) {
+		assert.Error(t, s.HandleLine("temp:1|c"))
+		assert.Error(t, s.HandleLine("users:1|s"), "sets are not supported")
+	})
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("server did not stop")
+	}
+}
+
+func TestStatsdServerAcceptBackoff(t *testing.T) {
+	r, err := NewRegistry("", "", 10)
+	require.NoError(t, err)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	fl := &failingListener{Listener: l, closed: make(chan struct{})}
+	s := &StatsdServer{registry: r, tcp: fl}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	s.Run(ctx)
+	assert.Less(t, fl.accepts, 10, "accept errors should be retried with backoff")
+}
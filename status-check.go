@@ -0,0 +1,118 @@
+package mon
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// CheckFunc checks the service and returns its state and message.
+// It should respect context's deadline, although scheduler will report timeout regardless
+type CheckFunc func(ctx context.Context) (State, string)
+
+// CheckConfig configures periodic check
+type CheckConfig struct {
+	// Interval between checks, defaults to 10s
+	Interval time.Duration
+	// Check timeout, defaults to interval
+	Timeout time.Duration
+	// Random delay up to Jitter is added to each interval, to avoid all checks running at once
+	Jitter time.Duration
+	// State set when check times out, defaults to Critical. Panic in check always results in Unknown
+	TimeoutState State
+	// Registry to record check duration in (as histogram in seconds, labelled with component name). Optional
+	Registry *Registry
+	// Name of duration metric, defaults to `check.duration`
+	MetricName string
+}
+
+// RunCheck runs check immediately and then every interval, updating status with the result, until context is cancelled.
+// It blocks so it should be ran in goroutine:
+//
+//	go dbState.RunCheck(ctx, mon.CheckConfig{Interval: time.Second * 10}, func(ctx context.Context) (mon.State, string) {
+//	    if err := db.PingContext(ctx); err != nil {
+//	        return mon.Critical, err.Error()
+//	    }
+//	    return mon.Ok, "running"
+//	})
+func (s *Status) RunCheck(ctx context.Context, cfg CheckConfig, check CheckFunc) error {
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Second * 10
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = cfg.Interval
+	}
+	if cfg.TimeoutState == StateInvalid {
+		cfg.TimeoutState = StateCritical
+	}
+	if cfg.MetricName == "" {
+		cfg.MetricName = "check.duration"
+	}
+	var duration Metric
+	if cfg.Registry != nil {
+		var err error
+		duration, err = cfg.Registry.RegisterOrGet(cfg.MetricName, NewHistogram(nil, "seconds"), map[string]string{"component": s.Name})
+		if err != nil {
+			return err
+		}
+	}
+	for {
+		start := time.Now()
+		state, msg := runCheck(ctx, cfg.Timeout, cfg.TimeoutState, check)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if duration != nil {
+			duration.Update(time.Since(start).Seconds())
+		}
+		if err := s.Update(state, msg); err != nil {
+			return err
+		}
+		wait := cfg.Interval
+		if cfg.Jitter > 0 {
+			wait += time.Duration(rand.Int63n(int64(cfg.Jitter)))
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+type checkResult struct {
+	state State
+	msg   string
+}
+
+// runCheck runs single check converting panics and timeouts into states
+func runCheck(ctx context.Context, timeout time.Duration, timeoutState State, check CheckFunc) (State, string) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	// buffered so hung check doesn't block goroutine forever after returning
+	result := make(chan checkResult, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				result <- checkResult{state: StateUnknown, msg: fmt.Sprintf("check panicked: %v", r)}
+			}
+		}()
+		state, msg := check(ctx)
+		result <- checkResult{state: state, msg: msg}
+	}()
+	select {
+	case r := <-result:
+		return r.state, r.msg
+	case <-ctx.Done():
+		// select picks randomly if check finished right at the deadline
+		select {
+		case r := <-result:
+			return r.state, r.msg
+		default:
+		}
+		return timeoutState, fmt.Sprintf("check timed out after %s", timeout)
+	}
+}
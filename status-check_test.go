@@ -0,0 +1,78 @@
+package mon
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunCheck(t *testing.T) {
+	s := NewStatus("app")
+	db := s.MustNewComponent("db")
+	r, err := NewRegistry("", "", 10)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	var runs int32
+	done := make(chan error)
+	go func() {
+		done <- db.RunCheck(ctx, CheckConfig{
+			Interval: time.Millisecond * 10,
+			Jitter:   time.Millisecond,
+			Registry: r,
+		}, func(ctx context.Context) (State, string) {
+			if atomic.AddInt32(&runs, 1) > 2 {
+				return StateWarning, "slow"
+			}
+			return StateOk, "running"
+		})
+	}()
+	assert.Eventually(t, func() bool { return db.GetState() == StateOk }, time.Second, time.Millisecond)
+	assert.Eventually(t, func() bool { return db.GetState() == StateWarning }, time.Second, time.Millisecond)
+	assert.Equal(t, "slow", db.GetMessage())
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+
+	m, err := r.GetMetric("check.duration", map[string]string{"component": "db"})
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, m.(Histogram).HistogramSnapshot().Count, uint64(3))
+}
+
+func TestRunCheckTimeoutAndPanic(t *testing.T) {
+	s := NewStatus("app")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hung := s.MustNewComponent("hung")
+	go hung.RunCheck(ctx, CheckConfig{Interval: time.Hour, Timeout: time.Millisecond * 10}, func(ctx context.Context) (State, string) {
+		time.Sleep(time.Second)
+		return StateOk, "too late"
+	})
+	assert.Eventually(t, func() bool { return hung.GetState() == StateCritical }, time.Second, time.Millisecond)
+	assert.Contains(t, hung.GetMessage(), "timed out after 10ms")
+
+	hungUnknown := s.MustNewComponent("hung-unknown")
+	go hungUnknown.RunCheck(ctx, CheckConfig{Interval: time.Hour, Timeout: time.Millisecond * 10, TimeoutState: StateUnknown}, func(ctx context.Context) (State, string) {
+		<-ctx.Done()
+		// returns well after the deadline, so timeout state is reported rather than its result
+		time.Sleep(time.Millisecond * 100)
+		return StateOk, "too late"
+	})
+	assert.Eventually(t, func() bool { return hungUnknown.GetState() == StateUnknown && hungUnknown.GetMessage() != "" }, time.Second, time.Millisecond)
+
+	crashing := s.MustNewComponent("crashing")
+	require.NoError(t, crashing.Update(StateOk, "fine"))
+	go crashing.RunCheck(ctx, CheckConfig{Interval: time.Hour}, func(ctx context.Context) (State, string) {
+		panic("nil pointer")
+	})
+	assert.Eventually(t, func() bool { return crashing.GetState() == StateUnknown }, time.Second, time.Millisecond)
+	assert.Equal(t, "check panicked: nil pointer", crashing.GetMessage())
+
+	t.Run("parent", func(t *testing.T) {
+		err := s.RunCheck(ctx, CheckConfig{}, func(ctx context.Context) (State, string) { return StateOk, "" })
+		assert.Error(t, err, "parent can't be updated")
+	})
+}
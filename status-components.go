@@ -0,0 +1,111 @@
+package mon
+
+import (
+	"fmt"
+	"time"
+)
+
+// GetComponent returns direct component with given name
+func (s *Status) GetComponent(name string) (c *Status, ok bool) {
+	s.RLock()
+	defer s.RUnlock()
+	c, ok = s.Components[name]
+	return c, ok
+}
+
+// GetOrCreateComponent returns existing component or creates new one if it does not exist.
+// Optional parameters (display name, description) are only used when creating
+func (s *Status) GetOrCreateComponent(name string, p ...string) *Status {
+	s.Lock()
+	defer s.Unlock()
+	if c, ok := s.Components[name]; ok {
+		return c
+	}
+	c := newStatus(name, s.updRecv, p...)
+	c.parent = s
+	s.setComponent(name, c)
+	return c
+}
+
+// RemoveComponent removes component, stops it (and its components) via Close() and recalculates state of the status immediately.
+// If last component is removed status becomes Unknown until it is updated again
+func (s *Status) RemoveComponent(name string) error {
+	s.Lock()
+	c, ok := s.Components[name]
+	if !ok {
+		s.Unlock()
+		return fmt.Errorf("component %s does not exist", name)
+	}
+	s.setComponent(name, nil)
+	s.Unlock()
+	c.Lock()
+	c.parent = nil
+	c.updSend = nil
+	c.Unlock()
+	c.Close()
+	s.refresh()
+	return nil
+}
+
+// RenameComponent changes name of the component
+func (s *Status) RenameComponent(oldName string, newName string) error {
+	s.Lock()
+	c, ok := s.Components[oldName]
+	if !ok {
+		s.Unlock()
+		return fmt.Errorf("component %s does not exist", oldName)
+	}
+	if _, ok := s.Components[newName]; ok {
+		s.Unlock()
+		return fmt.Errorf("component %s already exists", newName)
+	}
+	s.setComponent(oldName, nil)
+	s.setComponent(newName, c)
+	s.Unlock()
+	// not under parent's lock, component's state change takes its lock and then parent's one
+	c.Lock()
+	c.Name = newName
+	c.Unlock()
+	// message of the status names its components
+	s.refresh()
+	return nil
+}
+
+// Close stops internal goroutine of the status and all of its components, stops TTL timer and closes subscriptions.
+// Closed status can still be updated but changes of its components are no longer propagated
+func (s *Status) Close() {
+	_, children := s.children()
+	for _, c := range children {
+		c.Close()
+	}
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+	s.Lock()
+	s.ttl = 0
+	s.resetTTL()
+	s.maintenanceTimer = resetSilenceTimer(s.maintenanceTimer, time.Time{}, nil)
+	s.ackTimer = resetSilenceTimer(s.ackTimer, time.Time{}, nil)
+	s.Unlock()
+	s.events.Lock()
+	for sub := range s.events.subs {
+		delete(s.events.subs, sub)
+		close(sub.ch)
+	}
+	s.events.Unlock()
+}
+
+// setComponent adds (or removes, if c is nil) component. Has to be called with lock held.
+// Map is replaced instead of modified so code that got it before (summary functions, JSON encoding) can iterate it safely
+func (s *Status) setComponent(name string, c *Status) {
+	components := make(map[string]*Status, len(s.Components)+1)
+	for k, v := range s.Components {
+		components[k] = v
+	}
+	if c == nil {
+		delete(components, name)
+	} else {
+		components[name] = c
+	}
+	s.Components = components
+}
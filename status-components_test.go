@@ -0,0 +1,114 @@
+package mon
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetOrCreateComponent(t *testing.T) {
+	s := NewStatus("app")
+	c1 := s.GetOrCreateComponent("backend1", "Backend 1")
+	c2 := s.GetOrCreateComponent("backend1")
+	assert.Same(t, c1, c2)
+	assert.Equal(t, "Backend 1", c1.DisplayName)
+	c, ok := s.GetComponent("backend1")
+	assert.True(t, ok)
+	assert.Same(t, c1, c)
+	_, ok = s.GetComponent("backend2")
+	assert.False(t, ok)
+	c1.MustUpdate(StateCritical, "down")
+	assert.Eventually(t, func() bool { return s.GetState() == StateCritical }, time.Second, time.Millisecond)
+}
+
+func TestRemoveComponent(t *testing.T) {
+	s := NewStatus("app")
+	b1 := s.MustNewComponent("backend1")
+	b2 := s.MustNewComponent("backend2")
+	b1.MustUpdate(StateOk, "ok")
+	b2.MustUpdate(StateCritical, "down")
+	assert.Eventually(t, func() bool { return s.GetState() == StateCritical }, time.Second, time.Millisecond)
+
+	require.NoError(t, s.RemoveComponent("backend2"))
+	s.RLock()
+	state, msg := s.State, s.Msg
+	s.RUnlock()
+	assert.Equal(t, StateOk, state, "state recalculated immediately")
+	assert.NotContains(t, msg, "backend2")
+	assert.Error(t, s.RemoveComponent("backend2"))
+	// removed component can still be updated but is detached
+	b2.MustUpdate(StateCritical, "still down")
+	time.Sleep(time.Millisecond * 10)
+	assert.Equal(t, StateOk, s.GetState())
+
+	require.NoError(t, s.RemoveComponent("backend1"))
+	assert.Equal(t, StateUnknown, s.GetState())
+	assert.Equal(t, "no components", s.GetMessage())
+	require.NoError(t, s.Update(StateOk, "leaf again"))
+}
+
+func TestRenameComponent(t *testing.T) {
+	s := NewStatus("app")
+	c := s.MustNewComponent("old")
+	s.MustNewComponent("other")
+	assert.Error(t, s.RenameComponent("old", "other"))
+	assert.Error(t, s.RenameComponent("nonexistent", "new"))
+	require.NoError(t, s.RenameComponent("old", "new"))
+	_, ok := s.GetComponent("old")
+	assert.False(t, ok)
+	n, ok := s.GetComponent("new")
+	assert.True(t, ok)
+	assert.Same(t, c, n)
+	assert.Equal(t, "new", c.Name)
+
+	t.Run("message refreshed", func(t *testing.T) {
+		require.NoError(t, c.Update(StateCritical, "down"))
+		assert.Eventually(t, func() bool { return s.GetState() == StateCritical }, time.Second, time.Millisecond)
+		require.NoError(t, s.RenameComponent("new", "renamed"))
+		s.RLock()
+		msg := s.Msg
+		s.RUnlock()
+		assert.Contains(t, msg, "[renamed]", "stored message (JSON, history) uses new name")
+		assert.NotContains(t, msg, "[new]")
+	})
+	t.Run("concurrent with state changes", func(t *testing.T) {
+		events, cancel := s.Subscribe()
+		defer cancel()
+		leaf := c.MustNewComponent("leaf")
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 100; i++ {
+				leaf.Update(State(i%2+1), "flapping")
+			}
+		}()
+		for i := 0; i < 100; i++ {
+			require.NoError(t, s.RenameComponent([]string{"renamed", "flapping"}[i%2], []string{"flapping", "renamed"}[i%2]))
+		}
+		<-done
+		assert.NotEmpty(t, events)
+	})
+}
+
+func TestStatusClose(t *testing.T) {
+	before := runtime.NumGoroutine()
+	s := NewStatus("app")
+	web := s.MustNewComponent("web")
+	for _, name := range []string{"app1", "app2", "app3"} {
+		web.MustNewComponent(name).SetTTL(time.Hour)
+	}
+	events, _ := s.Subscribe()
+	s.Close()
+	s.Close()
+	_, ok := <-events
+	assert.False(t, ok, "subscriptions are closed")
+	// not using Eventually as it runs condition in its own goroutine
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	assert.LessOrEqual(t, runtime.NumGoroutine(), before, "update goroutines exit")
+}
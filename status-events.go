@@ -0,0 +1,101 @@
+package mon
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultEventBuffer is size of subscription's channel buffer when not specified
+var DefaultEventBuffer = 64
+
+// StatusEvent describes state change of the status or one of its components
+type StatusEvent struct {
+	// Path of component names relative to subscribed status, empty for the status itself
+	Path []string  `json:"path"`
+	Name string    `json:"name"`
+	From State     `json:"from"`
+	To   State     `json:"to"`
+	Msg  string    `json:"msg"`
+	Ts   time.Time `json:"ts"`
+}
+
+type subscription struct {
+	ch chan StatusEvent
+}
+
+type subscribers struct {
+	sync.Mutex
+	subs map[*subscription]struct{}
+}
+
+// Subscribe returns channel of state changes of the status and all of its components (including ones added later)
+// and function to cancel subscription, which also closes the channel.
+// Events are delivered without blocking updaters so if channel's buffer (optional parameter, defaults to DefaultEventBuffer) is full, events are dropped
+func (s *Status) Subscribe(buffer ...int) (events <-chan StatusEvent, cancel func()) {
+	size := DefaultEventBuffer
+	if len(buffer) > 0 && buffer[0] >= 0 {
+		size = buffer[0]
+	}
+	sub := &subscription{ch: make(chan StatusEvent, size)}
+	s.events.Lock()
+	if s.events.subs == nil {
+		s.events.subs = make(map[*subscription]struct{})
+	}
+	s.events.subs[sub] = struct{}{}
+	s.events.Unlock()
+	var once sync.Once
+	return sub.ch, func() {
+		once.Do(func() {
+			s.events.Lock()
+			// might be already closed by Close()
+			if _, ok := s.events.subs[sub]; ok {
+				delete(s.events.subs, sub)
+				close(sub.ch)
+			}
+			s.events.Unlock()
+		})
+	}
+}
+
+// OnChange calls f for each state change of the status and all of its components.
+// Calls are made sequentially from separate goroutine so slow callback does not block updaters; returned function cancels it
+//
+//	mon.GlobalStatus.OnChange(func(ev mon.StatusEvent) {
+//	    log.Printf("%s: %d -> %d: %s", strings.Join(ev.Path, "/"), ev.From, ev.To, ev.Msg)
+//	})
+func (s *Status) OnChange(f func(StatusEvent)) (cancel func()) {
+	events, cancel := s.Subscribe()
+	go func() {
+		for ev := range events {
+			f(ev)
+		}
+	}()
+	return cancel
+}
+
+// notify delivers event to subscribers of the status and all of its parents. Has to be called with lock held
+func (s *Status) notify(ev StatusEvent) {
+	s.events.deliver(ev)
+	path := []string{s.Name}
+	cur := s.parent
+	for cur != nil {
+		ev.Path = path
+		cur.events.deliver(ev)
+		cur.RLock()
+		path = append([]string{cur.Name}, path...)
+		parent := cur.parent
+		cur.RUnlock()
+		cur = parent
+	}
+}
+
+func (e *subscribers) deliver(ev StatusEvent) {
+	e.Lock()
+	defer e.Unlock()
+	for sub := range e.subs {
+		select {
+		case sub.ch <- ev:
+		default:
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package mon
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func nextEvent(t *testing.T, events <-chan StatusEvent) StatusEvent {
+	t.Helper()
+	select {
+	case ev := <-events:
+		return ev
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for event")
+	}
+	return StatusEvent{}
+}
+
+func TestSubscribe(t *testing.T) {
+	s := NewStatus("app")
+	web := s.MustNewComponent("web")
+	events, cancel := s.Subscribe()
+	app1 := web.MustNewComponent("app1")
+	webEvents, webCancel := web.Subscribe()
+	defer webCancel()
+
+	app1.MustUpdate(StateCritical, "down")
+	ev := nextEvent(t, webEvents)
+	assert.Equal(t, []string{"app1"}, ev.Path)
+	assert.Equal(t, "app1", ev.Name)
+	assert.Equal(t, StateUnknown, ev.From)
+	assert.Equal(t, StateCritical, ev.To)
+	assert.Equal(t, "down", ev.Msg)
+
+	// component event and then state changes of its parents as they get recalculated
+	got := map[string]StatusEvent{}
+	for i := 0; i < 3; i++ {
+		ev := nextEvent(t, events)
+		got[ev.Name] = ev
+	}
+	assert.Equal(t, []string{"web", "app1"}, got["app1"].Path)
+	assert.Equal(t, []string{"web"}, got["web"].Path)
+	assert.Empty(t, got["app"].Path)
+	assert.Equal(t, StateCritical, got["app"].To)
+
+	app1.MustUpdate(StateCritical, "still down")
+	select {
+	case ev := <-events:
+		t.Fatalf("unexpected event without state change: %+v", ev)
+	case <-time.After(time.Millisecond * 20):
+	}
+
+	cancel()
+	cancel()
+	_, ok := <-events
+	assert.False(t, ok, "channel closed after cancel")
+	app1.MustUpdate(StateOk, "up")
+	for {
+		ev := nextEvent(t, webEvents)
+		if ev.Name == "app1" && ev.To == StateOk {
+			break
+		}
+	}
+}
+
+func TestSubscribeDoesNotBlock(t *testing.T) {
+	s := NewStatus("app")
+	events, cancel := s.Subscribe(1)
+	defer cancel()
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 10; i++ {
+			s.MustUpdate(StateOk, "")
+			s.MustUpdate(StateCritical, "")
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("update blocked on full subscription")
+	}
+	assert.Len(t, events, 1)
+}
+
+func TestOnChange(t *testing.T) {
+	s := NewStatus("app")
+	db := s.MustNewComponent("db")
+	got := make(chan StatusEvent, 10)
+	cancel := s.OnChange(func(ev StatusEvent) {
+		if len(ev.Path) == 0 && ev.To == StateCritical {
+			got <- ev
+		}
+	})
+	defer cancel()
+	db.MustUpdate(StateOk, "ok")
+	db.MustUpdate(StateCritical, "down")
+	ev := nextEvent(t, got)
+	require.Equal(t, "app", ev.Name)
+	assert.Contains(t, ev.Msg, "down")
+}
@@ -0,0 +1,146 @@
+package mon
+
+import (
+	"fmt"
+	"time"
+)
+
+// HysteresisConfig configures how many consecutive results (and for how long) new state has to be reported
+// before component actually changes its state
+type HysteresisConfig struct {
+	// Consecutive results with the new state required to change state
+	Count int
+	// Minimum time new state has to be reported for. As state is only evaluated on update,
+	// change happens on first update after that time
+	Duration time.Duration
+}
+
+// FlapConfig configures Nagios-style flap detection
+type FlapConfig struct {
+	// Number of recent results to calculate state change percentage from, defaults to 21
+	History int
+	// Component starts flapping when weighted state change percentage goes above High (default 50)
+	// and stops when it goes below Low (default 25)
+	High float64
+	Low  float64
+	// State reported while flapping. Zero value keeps reporting actual state; message is prefixed in both cases
+	State State
+}
+
+// SetHysteresis enables hysteresis on the component. State changes only after being reported Count times in a row
+// and (if set) for at least Duration; until then previous state and message are kept.
+// First update and update after component went stale are always applied immediately.
+//
+// It should be only used on components without children, state of parent is always generated from children
+func (s *Status) SetHysteresis(cfg HysteresisConfig) {
+	s.Lock()
+	defer s.Unlock()
+	if cfg.Count < 1 {
+		cfg.Count = 1
+	}
+	s.hysteresis = cfg
+	s.pendingCount = 0
+}
+
+// SetFlapDetection enables flap detection on the component. Percentage of state changes is calculated over
+// recent results, weighted towards newer ones, and when it goes above threshold component is marked as flapping
+//
+// It should be only used on components without children, state of parent is always generated from children
+func (s *Status) SetFlapDetection(cfg FlapConfig) {
+	s.Lock()
+	defer s.Unlock()
+	if cfg.History < 3 {
+		cfg.History = 21
+	}
+	if cfg.High <= 0 {
+		cfg.High = 50
+	}
+	if cfg.Low <= 0 {
+		cfg.Low = 25
+	}
+	s.flap = cfg
+	s.flapHistory = make([]State, 0, cfg.History)
+	s.Flapping = false
+	s.flapPercent = 0
+}
+
+// FlapPercent returns current weighted percentage of state changes, when flap detection is enabled
+func (s *Status) FlapPercent() float64 {
+	s.RLock()
+	defer s.RUnlock()
+	return s.flapPercent
+}
+
+// filterUpdate applies flap detection and hysteresis to state reported by Update. Has to be called with lock held
+func (s *Status) filterUpdate(state State, message string) (State, string) {
+	if s.flap.History > 0 {
+		s.recordFlap(state)
+	}
+	if s.hysteresis.Count > 0 {
+		state, message = s.applyHysteresis(state, message)
+	}
+	if s.Flapping {
+		if s.flap.State != StateInvalid {
+			state = s.flap.State
+		}
+		message = fmt.Sprintf("flapping (%.0f%% state changes): %s", s.flapPercent, message)
+	}
+	return state, message
+}
+
+func (s *Status) applyHysteresis(state State, message string) (State, string) {
+	now := time.Now()
+	if state == s.stableState || s.stableState == StateInvalid || s.Stale {
+		s.stableState = state
+		s.stableMsg = message
+		s.pendingCount = 0
+		return state, message
+	}
+	if s.pendingCount == 0 || state != s.pendingState {
+		s.pendingState = state
+		s.pendingSince = now
+		s.pendingCount = 0
+	}
+	s.pendingCount++
+	if s.pendingCount >= s.hysteresis.Count && now.Sub(s.pendingSince) >= s.hysteresis.Duration {
+		s.stableState = state
+		s.stableMsg = message
+		s.pendingCount = 0
+		return state, message
+	}
+	return s.stableState, s.stableMsg
+}
+
+// recordFlap adds state to history and recalculates flapping. Like in Nagios, state changes are weighted
+// linearly from 0.8 for oldest to 1.2 for newest so recent changes count more
+func (s *Status) recordFlap(state State) {
+	if len(s.flapHistory) == s.flap.History {
+		copy(s.flapHistory, s.flapHistory[1:])
+		s.flapHistory = s.flapHistory[:len(s.flapHistory)-1]
+	}
+	s.flapHistory = append(s.flapHistory, state)
+	s.flapPercent = flapPercent(s.flapHistory, s.flap.History)
+	switch {
+	case !s.Flapping && s.flapPercent >= s.flap.High:
+		s.Flapping = true
+	case s.Flapping && s.flapPercent < s.flap.Low:
+		s.Flapping = false
+	}
+}
+
+// flapPercent calculates weighted percentage of state changes in history of given size
+func flapPercent(history []State, size int) float64 {
+	transitions := size - 1
+	if len(history) < 2 || transitions < 2 {
+		return 0
+	}
+	// align partial history to the newest end so weights don't change while it fills up
+	offset := size - len(history)
+	var changes float64
+	for i := 1; i < len(history); i++ {
+		if history[i] != history[i-1] {
+			changes += 0.8 + 0.4*float64(offset+i-1)/float64(transitions-1)
+		}
+	}
+	return changes / float64(transitions) * 100
+}
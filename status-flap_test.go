@@ -0,0 +1,94 @@
+package mon
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHysteresis(t *testing.T) {
+	s := NewStatus("app")
+	db := s.MustNewComponent("db")
+	db.SetHysteresis(HysteresisConfig{Count: 3})
+	db.MustUpdate(StateOk, "running")
+	assert.Equal(t, StateOk, db.GetState(), "first update applies immediately")
+	db.MustUpdate(StateCritical, "down")
+	db.MustUpdate(StateCritical, "down")
+	assert.Equal(t, StateOk, db.GetState())
+	assert.Equal(t, "running", db.GetMessage())
+	db.MustUpdate(StateOk, "running again")
+	assert.Equal(t, "running again", db.GetMessage())
+	db.MustUpdate(StateCritical, "down")
+	db.MustUpdate(StateCritical, "down")
+	assert.Equal(t, StateOk, db.GetState(), "ok in between resets counter")
+	db.MustUpdate(StateCritical, "down")
+	assert.Equal(t, StateCritical, db.GetState())
+	assert.Equal(t, "down", db.GetMessage())
+	assert.Eventually(t, func() bool { return s.GetState() == StateCritical }, time.Second, time.Millisecond)
+	// pending state changes restart count
+	db.MustUpdate(StateWarning, "slow")
+	db.MustUpdate(StateWarning, "slow")
+	db.MustUpdate(StateOk, "ok")
+	db.MustUpdate(StateOk, "ok")
+	assert.Equal(t, StateCritical, db.GetState())
+	db.MustUpdate(StateOk, "ok")
+	assert.Equal(t, StateOk, db.GetState())
+}
+
+func TestHysteresisDuration(t *testing.T) {
+	s := NewStatus("app")
+	s.SetHysteresis(HysteresisConfig{Duration: time.Millisecond * 50})
+	s.MustUpdate(StateOk, "ok")
+	s.MustUpdate(StateCritical, "down")
+	assert.Equal(t, StateOk, s.GetState())
+	time.Sleep(time.Millisecond * 60)
+	s.MustUpdate(StateCritical, "down")
+	assert.Equal(t, StateCritical, s.GetState())
+}
+
+func TestFlapDetection(t *testing.T) {
+	s := NewStatus("app")
+	s.SetFlapDetection(FlapConfig{State: StateWarning})
+	s.MustUpdate(StateOk, "ok")
+	assert.False(t, s.Flapping)
+	for i := 0; i < 10; i++ {
+		s.MustUpdate(StateCritical, "down")
+		s.MustUpdate(StateOk, "ok")
+	}
+	assert.True(t, s.Flapping)
+	assert.Greater(t, s.FlapPercent(), 50.0)
+	assert.Equal(t, StateWarning, s.GetState())
+	assert.Contains(t, s.GetMessage(), "flapping (")
+	assert.Contains(t, s.GetMessage(), "state changes): ok")
+	for i := 0; i < 20; i++ {
+		s.MustUpdate(StateOk, "ok")
+	}
+	assert.False(t, s.Flapping)
+	assert.Equal(t, 0.0, s.FlapPercent())
+	assert.Equal(t, StateOk, s.GetState())
+	assert.Equal(t, "ok", s.GetMessage())
+}
+
+func TestFlapDetectionWithHysteresis(t *testing.T) {
+	s := NewStatus("app")
+	s.SetHysteresis(HysteresisConfig{Count: 2})
+	s.SetFlapDetection(FlapConfig{})
+	s.MustUpdate(StateOk, "ok")
+	for i := 0; i < 10; i++ {
+		s.MustUpdate(StateCritical, "down")
+		s.MustUpdate(StateOk, "ok")
+	}
+	assert.True(t, s.Flapping, "flapping is detected on raw results")
+	assert.Equal(t, StateOk, s.GetState(), "hysteresis keeps state")
+	assert.Equal(t, "flapping (100% state changes): ok", s.GetMessage())
+}
+
+func TestFlapPercent(t *testing.T) {
+	assert.Equal(t, 0.0, flapPercent([]State{StateOk}, 21))
+	assert.Equal(t, 0.0, flapPercent([]State{StateOk, StateOk, StateOk}, 3))
+	assert.InDelta(t, 100.0, flapPercent([]State{StateOk, StateCritical, StateOk}, 3), 0.001)
+	// newest change weights 1.2, oldest 0.8
+	assert.InDelta(t, 60.0, flapPercent([]State{StateOk, StateOk, StateCritical}, 3), 0.001)
+	assert.InDelta(t, 40.0, flapPercent([]State{StateOk, StateCritical, StateCritical}, 3), 0.001)
+}
@@ -0,0 +1,99 @@
+package mon
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DefaultHistorySize is number of state transitions kept per component
+var DefaultHistorySize = 16
+
+// StateTransition records single change of component's state
+type StateTransition struct {
+	From State  `json:"from"`
+	To   State  `json:"to"`
+	Msg  string `json:"msg"`
+	// time of the change
+	Ts time.Time `json:"ts"`
+	// how long component was in previous state
+	Duration time.Duration `json:"duration"`
+}
+
+// SetHistorySize changes number of state transitions kept for the component, 0 disables history
+func (s *Status) SetHistorySize(n int) {
+	s.Lock()
+	defer s.Unlock()
+	if n < 0 {
+		n = 0
+	}
+	h := s.historyLocked()
+	if len(h) > n {
+		h = h[len(h)-n:]
+	}
+	s.history = make([]StateTransition, n)
+	s.historyPos = copy(s.history, h)
+	s.historyLen = s.historyPos
+	if n > 0 {
+		s.historyPos %= n
+	}
+}
+
+// History returns recorded state transitions, oldest first
+func (s *Status) History() []StateTransition {
+	s.RLock()
+	defer s.RUnlock()
+	return s.historyLocked()
+}
+
+func (s *Status) historyLocked() []StateTransition {
+	out := make([]StateTransition, 0, s.historyLen)
+	start := s.historyPos - s.historyLen
+	if start < 0 {
+		start += len(s.history)
+	}
+	for i := 0; i < s.historyLen; i++ {
+		out = append(out, s.history[(start+i)%len(s.history)])
+	}
+	return out
+}
+
+// recordTransition adds state change to history ring buffer. Has to be called with lock held
+func (s *Status) recordTransition(t StateTransition) {
+	if len(s.history) == 0 {
+		return
+	}
+	s.history[s.historyPos] = t
+	s.historyPos = (s.historyPos + 1) % len(s.history)
+	if s.historyLen < len(s.history) {
+		s.historyLen++
+	}
+}
+
+// statusWithHistory is used to render status tree with history of each component included
+type statusWithHistory struct {
+	*Status
+	History    []StateTransition             `json:"history,omitempty"`
+	Components map[string]*statusWithHistory `json:"components,omitempty"`
+}
+
+func (s *Status) withHistory() *statusWithHistory {
+	out := &statusWithHistory{
+		Status:  s,
+		History: s.History(),
+	}
+	names, children := s.children()
+	if len(children) > 0 {
+		out.Components = make(map[string]*statusWithHistory, len(children))
+		for i, c := range children {
+			out.Components[names[i]] = c.withHistory()
+		}
+	}
+	return out
+}
+
+// wantHistory returns true if request asks for history via ?history=1
+func wantHistory(req *http.Request) bool {
+	h, _ := strconv.ParseBool(req.URL.Query().Get("history"))
+	return h
+}
@@ -0,0 +1,88 @@
+package mon
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatusHistory(t *testing.T) {
+	s := NewStatus("app")
+	s.MustUpdate(StateOk, "running")
+	s.MustUpdate(StateOk, "still running")
+	s.MustUpdate(StateCritical, "down")
+	h := s.History()
+	require.Len(t, h, 2, "only state changes are recorded")
+	assert.Equal(t, StateUnknown, h[0].From)
+	assert.Equal(t, StateOk, h[0].To)
+	assert.Equal(t, "running", h[0].Msg)
+	assert.Equal(t, StateOk, h[1].From)
+	assert.Equal(t, StateCritical, h[1].To)
+	assert.Equal(t, "down", h[1].Msg)
+	assert.Equal(t, h[1].Ts.Sub(h[0].Ts), h[1].Duration)
+}
+
+func TestStatusHistoryRing(t *testing.T) {
+	s := NewStatus("app")
+	s.SetHistorySize(3)
+	states := []State{StateOk, StateWarning, StateCritical, StateOk, StateWarning}
+	for _, st := range states {
+		s.MustUpdate(st, "")
+	}
+	h := s.History()
+	require.Len(t, h, 3)
+	assert.Equal(t, StateCritical, h[0].To)
+	assert.Equal(t, StateOk, h[1].To)
+	assert.Equal(t, StateWarning, h[2].To)
+
+	s.SetHistorySize(2)
+	h = s.History()
+	require.Len(t, h, 2, "shrinking keeps newest")
+	assert.Equal(t, StateOk, h[0].To)
+	assert.Equal(t, StateWarning, h[1].To)
+	s.MustUpdate(StateCritical, "")
+	assert.Equal(t, StateCritical, s.History()[1].To)
+
+	s.SetHistorySize(5)
+	s.MustUpdate(StateOk, "")
+	assert.Len(t, s.History(), 3, "growing keeps old entries")
+
+	s.SetHistorySize(0)
+	s.MustUpdate(StateCritical, "")
+	assert.Empty(t, s.History())
+}
+
+func TestStatusWithHistory(t *testing.T) {
+	s := NewStatus("app")
+	db := s.MustNewComponent("db")
+	db.MustUpdate(StateOk, "running")
+	db.MustUpdate(StateCritical, "down")
+	js, err := json.Marshal(s.withHistory())
+	require.NoError(t, err)
+	var out struct {
+		Name       string `json:"name"`
+		Components map[string]struct {
+			Msg     string            `json:"msg"`
+			History []StateTransition `json:"history"`
+		} `json:"components"`
+	}
+	require.NoError(t, json.Unmarshal(js, &out))
+	assert.Equal(t, "app", out.Name)
+	assert.Equal(t, "down", out.Components["db"].Msg)
+	require.Len(t, out.Components["db"].History, 2)
+	assert.Equal(t, StateCritical, out.Components["db"].History[1].To)
+
+	js, err = json.Marshal(s)
+	require.NoError(t, err)
+	assert.NotContains(t, string(js), "history")
+}
+
+func TestWantHistory(t *testing.T) {
+	assert.True(t, wantHistory(httptest.NewRequest("GET", "/health?history=1", nil)))
+	assert.True(t, wantHistory(httptest.NewRequest("GET", "/health?history=true", nil)))
+	assert.False(t, wantHistory(httptest.NewRequest("GET", "/health?history=0", nil)))
+	assert.False(t, wantHistory(httptest.NewRequest("GET", "/health", nil)))
+}
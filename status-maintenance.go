@@ -0,0 +1,143 @@
+package mon
+
+import (
+	"fmt"
+	"time"
+)
+
+// Silence describes maintenance or acknowledgement of the component
+type Silence struct {
+	Reason string `json:"reason"`
+	// who set it, optional
+	By    string    `json:"by,omitempty"`
+	Since time.Time `json:"since"`
+	// expiry, zero means it has to be cleared manually
+	Until time.Time `json:"until,omitempty"`
+}
+
+// Active returns true if silence is set and did not expire yet
+func (m *Silence) Active() bool {
+	return m != nil && (m.Until.IsZero() || time.Now().Before(m.Until))
+}
+
+// SetMaintenance puts component into maintenance until given time (zero time means until ClearMaintenance() is called).
+// Component's state is still reported but it is not taken into account when calculating parent's state.
+// Returns error if until is in the past
+//
+//	db.SetMaintenance("pg upgrade", time.Now().Add(time.Hour*2))
+func (s *Status) SetMaintenance(reason string, until time.Time, by ...string) error {
+	if err := checkSilenceUntil(until); err != nil {
+		return err
+	}
+	s.Lock()
+	s.Maintenance = newSilence(reason, until, by...)
+	s.maintenanceTimer = resetSilenceTimer(s.maintenanceTimer, until, s.expireSilences)
+	s.Unlock()
+	s.propagate()
+	return nil
+}
+
+// ClearMaintenance ends maintenance of the component
+func (s *Status) ClearMaintenance() {
+	s.Lock()
+	s.Maintenance = nil
+	s.maintenanceTimer = resetSilenceTimer(s.maintenanceTimer, time.Time{}, nil)
+	s.Unlock()
+	s.propagate()
+}
+
+// InMaintenance returns true if component is in maintenance
+func (s *Status) InMaintenance() bool {
+	s.RLock()
+	defer s.RUnlock()
+	return s.Maintenance.Active()
+}
+
+// Acknowledge acknowledges current problem of the component until given time (zero time means until the state changes).
+// Like maintenance it excludes component from parent's state, but it is also cleared on next state change.
+// Returns error if until is in the past
+func (s *Status) Acknowledge(reason string, until time.Time, by ...string) error {
+	if err := checkSilenceUntil(until); err != nil {
+		return err
+	}
+	s.Lock()
+	s.Acknowledged = newSilence(reason, until, by...)
+	s.ackTimer = resetSilenceTimer(s.ackTimer, until, s.expireSilences)
+	s.Unlock()
+	s.propagate()
+	return nil
+}
+
+// ClearAcknowledgement removes acknowledgement of the component
+func (s *Status) ClearAcknowledgement() {
+	s.Lock()
+	s.Acknowledged = nil
+	s.ackTimer = resetSilenceTimer(s.ackTimer, time.Time{}, nil)
+	s.Unlock()
+	s.propagate()
+}
+
+// IsAcknowledged returns true if component's problem is acknowledged
+func (s *Status) IsAcknowledged() bool {
+	s.RLock()
+	defer s.RUnlock()
+	return s.Acknowledged.Active()
+}
+
+// silenced returns true if component is excluded from its parent's state. Has to be called with lock held
+func (s *Status) silenced() bool {
+	return s.Maintenance.Active() || s.Acknowledged.Active()
+}
+
+// clearAcknowledgement is called on state change. Has to be called with lock held
+func (s *Status) clearAcknowledgement() {
+	if s.Acknowledged == nil {
+		return
+	}
+	s.Acknowledged = nil
+	s.ackTimer = resetSilenceTimer(s.ackTimer, time.Time{}, nil)
+}
+
+// expireSilences removes expired maintenance and acknowledgement and notifies parent
+func (s *Status) expireSilences() {
+	s.Lock()
+	if s.Maintenance != nil && !s.Maintenance.Active() {
+		s.Maintenance = nil
+	}
+	if s.Acknowledged != nil && !s.Acknowledged.Active() {
+		s.Acknowledged = nil
+	}
+	s.Unlock()
+	s.propagate()
+}
+
+// checkSilenceUntil returns error if until is set and already passed, as such silence would never be active
+func checkSilenceUntil(until time.Time) error {
+	if !until.IsZero() && !time.Now().Before(until) {
+		return fmt.Errorf("until [%s] is in the past", until.Format(time.RFC3339))
+	}
+	return nil
+}
+
+func newSilence(reason string, until time.Time, by ...string) *Silence {
+	m := &Silence{
+		Reason: reason,
+		Since:  time.Now(),
+		Until:  until,
+	}
+	if len(by) > 0 {
+		m.By = by[0]
+	}
+	return m
+}
+
+// resetSilenceTimer stops old timer and, if until is set, starts new one calling f at that time
+func resetSilenceTimer(t *time.Timer, until time.Time, f func()) *time.Timer {
+	if t != nil {
+		t.Stop()
+	}
+	if until.IsZero() || f == nil {
+		return nil
+	}
+	return time.AfterFunc(time.Until(until), f)
+}
@@ -0,0 +1,76 @@
+package mon
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaintenance(t *testing.T) {
+	s := NewStatus("app")
+	db := s.MustNewComponent("db")
+	web := s.MustNewComponent("web")
+	web.MustUpdate(StateOk, "ok")
+	db.MustUpdate(StateCritical, "down")
+	assert.Eventually(t, func() bool { return s.GetState() == StateCritical }, time.Second, time.Millisecond)
+
+	require.NoError(t, db.SetMaintenance("pg upgrade", time.Time{}, "admin"))
+	assert.True(t, db.InMaintenance())
+	assert.Equal(t, StateOk, s.GetState())
+	assert.Equal(t, http.StatusOK, healthcheckHTTPStatus(s.GetState()))
+	assert.Equal(t, StateCritical, db.GetState(), "component still reports its state")
+	assert.Contains(t, s.GetMessage(), "[db]down (maintenance: pg upgrade)")
+	assert.Equal(t, "admin", db.Maintenance.By)
+	db.MustUpdate(StateOk, "ok")
+	db.MustUpdate(StateCritical, "down")
+	assert.True(t, db.InMaintenance(), "maintenance is not cleared by state change")
+
+	db.ClearMaintenance()
+	assert.False(t, db.InMaintenance())
+	assert.Equal(t, StateCritical, s.GetState())
+}
+
+func TestMaintenanceExpiry(t *testing.T) {
+	s := NewStatus("app")
+	db := s.MustNewComponent("db")
+	db.MustUpdate(StateCritical, "down")
+	require.NoError(t, db.SetMaintenance("pg upgrade", time.Now().Add(time.Millisecond*20)))
+	assert.Equal(t, StateOk, s.GetState())
+	assert.Eventually(t, func() bool {
+		s.RLock()
+		defer s.RUnlock()
+		return s.State == StateCritical
+	}, time.Second, time.Millisecond, "parent recalculated after expiry")
+	assert.False(t, db.InMaintenance())
+	db.RLock()
+	assert.Nil(t, db.Maintenance)
+	db.RUnlock()
+
+	assert.Error(t, db.SetMaintenance("too late", time.Now().Add(-time.Minute)))
+	assert.False(t, db.InMaintenance())
+}
+
+func TestAcknowledge(t *testing.T) {
+	s := NewStatus("app")
+	db := s.MustNewComponent("db")
+	db.MustUpdate(StateCritical, "down")
+	db.Acknowledge("looking into it", time.Time{})
+	assert.True(t, db.IsAcknowledged())
+	assert.Equal(t, StateOk, s.GetState())
+	assert.Contains(t, s.GetMessage(), "(acknowledged: looking into it)")
+	db.MustUpdate(StateCritical, "still down")
+	assert.True(t, db.IsAcknowledged(), "same state keeps acknowledgement")
+	db.MustUpdate(StateOk, "ok")
+	assert.False(t, db.IsAcknowledged(), "state change clears acknowledgement")
+	db.MustUpdate(StateCritical, "down again")
+	assert.Equal(t, StateCritical, s.GetState())
+
+	assert.Error(t, db.Acknowledge("again", time.Now().Add(-time.Second)), "until in the past")
+	assert.False(t, db.IsAcknowledged())
+	require.NoError(t, db.Acknowledge("again", time.Time{}))
+	db.ClearAcknowledgement()
+	assert.False(t, db.IsAcknowledged())
+}
@@ -0,0 +1,190 @@
+package mon
+
+// Criticality defines how component's state affects its parent
+type Criticality string
+
+const (
+	// CriticalityRequired component's state is used as is. It is the default
+	CriticalityRequired = Criticality("")
+	// CriticalityOptional component's Critical, Unknown or Invalid state is capped to Warning in parent's summary
+	CriticalityOptional = Criticality("optional")
+	// CriticalityIgnored component is not taken into account when calculating parent's state, only shown in the message
+	CriticalityIgnored = Criticality("ignored")
+)
+
+// StatePolicy generates state of parent status from its components. SummarizeStatusState (worst state wins) is the default
+type StatePolicy func(components *map[string]*Status) State
+
+// MessagePolicy generates message of parent status from its components. SummarizeStatusMessage is the default
+type MessagePolicy func(components *map[string]*Status) string
+
+// SetStatePolicy changes how state of the status is calculated from its components and recalculates it.
+// It should be set before components are updated, nil restores the default
+//
+//	cache := app.MustNewComponent("cache")
+//	cache.SetStatePolicy(mon.PolicyQuorum(2)) // 2 of 3 nodes are enough
+func (s *Status) SetStatePolicy(p StatePolicy) {
+	if p == nil {
+		p = SummarizeStatusState
+	}
+	s.Lock()
+	s.summaryState = p
+	s.Unlock()
+	s.recalculate()
+}
+
+// SetMessagePolicy changes how message of the status is generated from its components, nil restores the default
+func (s *Status) SetMessagePolicy(p MessagePolicy) {
+	if p == nil {
+		p = SummarizeStatusMessage
+	}
+	s.Lock()
+	s.summaryMessage = p
+	s.Unlock()
+	s.recalculate()
+}
+
+// SetCriticality sets how component's state affects state of its parent
+//
+//	recommendations := app.MustNewComponent("recommendations")
+//	recommendations.SetCriticality(mon.CriticalityOptional)
+func (s *Status) SetCriticality(c Criticality) {
+	s.Lock()
+	s.Criticality = c
+	s.Unlock()
+	s.propagate()
+}
+
+// recalculate schedules recalculation of state from components; channel is buffered so if one is already pending it is enough
+func (s *Status) recalculate() {
+	s.RLock()
+	hasComponents := len(s.Components) > 0
+	s.RUnlock()
+	if !hasComponents {
+		return
+	}
+	select {
+	case s.updRecv <- true:
+	default:
+	}
+}
+
+// PolicyWorst returns worst state of components ( critical>unknown>warning>ok ). It is the default policy
+func PolicyWorst() StatePolicy {
+	return SummarizeStatusState
+}
+
+// PolicyQuorum returns Ok if at least n components are Ok, Warning if at least n are Ok or Warning, Critical otherwise
+func PolicyQuorum(n int) StatePolicy {
+	return func(components *map[string]*Status) State {
+		var ok, warning int
+		for _, c := range *components {
+			state, count := componentState(c)
+			if !count {
+				continue
+			}
+			switch state {
+			case StateOk:
+				ok++
+			case StateWarning:
+				warning++
+			}
+		}
+		switch {
+		case ok >= n:
+			return StateOk
+		case ok+warning >= n:
+			return StateWarning
+		}
+		return StateCritical
+	}
+}
+
+// PolicyAnyOk is meant for redundant backends: it returns Ok if all components are Ok,
+// Warning if at least one of them is Ok and worst state of the components if none are
+func PolicyAnyOk() StatePolicy {
+	return func(components *map[string]*Status) State {
+		var ok, counted int
+		for _, c := range *components {
+			state, count := componentState(c)
+			if !count {
+				continue
+			}
+			counted++
+			if state == StateOk {
+				ok++
+			}
+		}
+		switch {
+		case ok == counted:
+			return StateOk
+		case ok > 0:
+			return StateWarning
+		}
+		return SummarizeStatusState(components)
+	}
+}
+
+// PolicyPercent degrades state based on percentage of failed (not Ok or Warning) components.
+// It returns Critical if more than critPercent failed, Warning if more than warnPercent failed or any component is in Warning, Ok otherwise
+func PolicyPercent(warnPercent float64, critPercent float64) StatePolicy {
+	return PolicyWeighted(nil, warnPercent, critPercent)
+}
+
+// PolicyWeighted works like PolicyPercent but each component counts with its weight (by component name, 1 if not in the map)
+//
+//	app.SetStatePolicy(mon.PolicyWeighted(map[string]float64{"db": 10, "cache": 1, "search": 2}, 0, 50))
+func PolicyWeighted(weights map[string]float64, warnPercent float64, critPercent float64) StatePolicy {
+	return func(components *map[string]*Status) State {
+		var total, failed float64
+		var warning bool
+		for name, c := range *components {
+			state, count := componentState(c)
+			if !count {
+				continue
+			}
+			weight := 1.0
+			if w, ok := weights[name]; ok {
+				weight = w
+			}
+			total += weight
+			switch state {
+			case StateOk:
+			case StateWarning:
+				warning = true
+			default:
+				failed += weight
+			}
+		}
+		if total <= 0 {
+			return SummarizeStatusState(components)
+		}
+		failedPercent := failed / total * 100
+		switch {
+		case failedPercent > critPercent:
+			return StateCritical
+		case failedPercent > warnPercent || warning:
+			return StateWarning
+		}
+		return StateOk
+	}
+}
+
+// componentState returns state of component as seen by its parent, with its criticality applied.
+// Ignored components and ones in maintenance or acknowledged should not be counted at all
+func componentState(c *Status) (state State, counted bool) {
+	c.RLock()
+	defer c.RUnlock()
+	if c.silenced() {
+		return c.State, false
+	}
+	switch c.Criticality {
+	case CriticalityIgnored:
+		return c.State, false
+	case CriticalityOptional:
+		if c.State != StateOk && c.State != StateWarning {
+			return StateWarning, true
+		}
+	}
+	return c.State, true
+}
@@ -0,0 +1,116 @@
+package mon
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testComponents(states map[string]State) *map[string]*Status {
+	m := make(map[string]*Status)
+	for name, state := range states {
+		m[name] = &Status{Name: name, State: state}
+	}
+	return &m
+}
+
+func TestPolicyQuorum(t *testing.T) {
+	p := PolicyQuorum(2)
+	assert.Equal(t, StateOk, p(testComponents(map[string]State{"a": StateOk, "b": StateOk, "c": StateCritical})))
+	assert.Equal(t, StateWarning, p(testComponents(map[string]State{"a": StateOk, "b": StateWarning, "c": StateCritical})))
+	assert.Equal(t, StateCritical, p(testComponents(map[string]State{"a": StateOk, "b": StateUnknown, "c": StateCritical})))
+}
+
+func TestPolicyAnyOk(t *testing.T) {
+	p := PolicyAnyOk()
+	assert.Equal(t, StateOk, p(testComponents(map[string]State{"a": StateOk, "b": StateOk})))
+	assert.Equal(t, StateWarning, p(testComponents(map[string]State{"a": StateOk, "b": StateCritical})))
+	assert.Equal(t, StateCritical, p(testComponents(map[string]State{"a": StateWarning, "b": StateCritical})))
+	assert.Equal(t, StateWarning, p(testComponents(map[string]State{"a": StateWarning, "b": StateWarning})))
+}
+
+func TestPolicyPercent(t *testing.T) {
+	p := PolicyPercent(0, 50)
+	assert.Equal(t, StateOk, p(testComponents(map[string]State{"a": StateOk, "b": StateOk, "c": StateOk, "d": StateOk})))
+	assert.Equal(t, StateWarning, p(testComponents(map[string]State{"a": StateOk, "b": StateOk, "c": StateOk, "d": StateWarning})))
+	assert.Equal(t, StateWarning, p(testComponents(map[string]State{"a": StateOk, "b": StateOk, "c": StateOk, "d": StateCritical})))
+	assert.Equal(t, StateWarning, p(testComponents(map[string]State{"a": StateOk, "b": StateOk, "c": StateUnknown, "d": StateCritical})))
+	assert.Equal(t, StateCritical, p(testComponents(map[string]State{"a": StateOk, "b": StateCritical, "c": StateUnknown, "d": StateCritical})))
+	p = PolicyPercent(25, 50)
+	assert.Equal(t, StateOk, p(testComponents(map[string]State{"a": StateOk, "b": StateOk, "c": StateOk, "d": StateCritical})))
+}
+
+func TestPolicyWeighted(t *testing.T) {
+	p := PolicyWeighted(map[string]float64{"db": 10}, 0, 50)
+	assert.Equal(t, StateCritical, p(testComponents(map[string]State{"db": StateCritical, "cache": StateOk, "search": StateOk})))
+	assert.Equal(t, StateWarning, p(testComponents(map[string]State{"db": StateOk, "cache": StateCritical, "search": StateCritical})))
+	assert.Equal(t, StateOk, p(testComponents(map[string]State{"db": StateOk, "cache": StateOk, "search": StateOk})))
+}
+
+func TestSetStatePolicy(t *testing.T) {
+	s := NewStatus("app")
+	cache := s.MustNewComponent("cache")
+	nodes := []*Status{cache.MustNewComponent("n1"), cache.MustNewComponent("n2"), cache.MustNewComponent("n3")}
+	for _, n := range nodes {
+		n.MustUpdate(StateOk, "ok")
+	}
+	nodes[0].MustUpdate(StateCritical, "down")
+	assert.Eventually(t, func() bool { return s.GetState() == StateCritical }, time.Second, time.Millisecond)
+	cache.SetStatePolicy(PolicyQuorum(2))
+	assert.Equal(t, StateOk, cache.GetState())
+	assert.Eventually(t, func() bool {
+		s.RLock()
+		defer s.RUnlock()
+		return s.State == StateOk
+	}, time.Second, time.Millisecond, "policy change is propagated")
+	nodes[1].MustUpdate(StateCritical, "down")
+	assert.Eventually(t, func() bool { return s.GetState() == StateCritical }, time.Second, time.Millisecond)
+
+	cache.SetMessagePolicy(func(*map[string]*Status) string { return "custom" })
+	assert.Equal(t, "custom", cache.GetMessage())
+	cache.SetStatePolicy(nil)
+	cache.SetMessagePolicy(nil)
+	nodes[1].MustUpdate(StateOk, "ok")
+	assert.Eventually(t, func() bool { return s.GetState() == StateCritical && cache.GetMessage() != "custom" }, time.Second, time.Millisecond)
+}
+
+func TestCriticality(t *testing.T) {
+	components := testComponents(map[string]State{"db": StateOk, "recommendations": StateCritical, "push": StateUnknown})
+	(*components)["recommendations"].Criticality = CriticalityOptional
+	assert.Equal(t, StateUnknown, SummarizeStatusState(components))
+	(*components)["push"].Criticality = CriticalityIgnored
+	assert.Equal(t, StateWarning, SummarizeStatusState(components))
+	assert.Equal(t, StateWarning, PolicyAnyOk()(components))
+	assert.Equal(t, StateOk, PolicyQuorum(1)(components))
+	assert.Equal(t, StateWarning, PolicyPercent(0, 0)(components))
+	(*components)["recommendations"].Criticality = CriticalityIgnored
+	assert.Equal(t, StateOk, SummarizeStatusState(components))
+	(*components)["db"].Criticality = CriticalityIgnored
+	assert.Equal(t, StateOk, SummarizeStatusState(components), "all components ignored")
+}
+
+func TestSetCriticality(t *testing.T) {
+	s := NewStatus("app")
+	db := s.MustNewComponent("db")
+	recs := s.MustNewComponent("recommendations")
+	db.MustUpdate(StateOk, "running")
+	recs.MustUpdate(StateCritical, "timeout")
+	assert.Eventually(t, func() bool { return s.GetState() == StateCritical }, time.Second, time.Millisecond)
+	recs.SetCriticality(CriticalityOptional)
+	assert.Equal(t, StateWarning, s.GetState())
+	assert.Equal(t, http.StatusOK, healthcheckHTTPStatus(s.GetState()))
+	assert.Eventually(t, func() bool {
+		s.RLock()
+		defer s.RUnlock()
+		return s.State == StateWarning
+	}, time.Second, time.Millisecond, "criticality change is propagated")
+	assert.Equal(t, StateCritical, recs.GetState(), "component keeps its own state")
+	assert.Contains(t, s.GetMessage(), "[recommendations]timeout")
+	js, err := json.Marshal(s)
+	require.NoError(t, err)
+	assert.Contains(t, string(js), `"criticality":"optional"`)
+}
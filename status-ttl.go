@@ -0,0 +1,56 @@
+package mon
+
+import (
+	"time"
+)
+
+// SetTTL enables staleness detection on the component. If it is not updated within ttl
+// its state is changed to Unknown (or the state passed as optional parameter) with "stale since ..." message, which then propagates to the parent.
+// Next Update() clears stale flag. Zero ttl disables staleness detection.
+//
+// It should be only used on components without children, state of parent is always generated from children
+func (s *Status) SetTTL(ttl time.Duration, staleState ...State) {
+	s.Lock()
+	defer s.Unlock()
+	s.ttl = ttl
+	s.staleState = StateUnknown
+	if len(staleState) > 0 {
+		s.staleState = staleState[0]
+	}
+	s.resetTTL()
+}
+
+// resetTTL restarts staleness timer. Has to be called with lock held
+func (s *Status) resetTTL() {
+	if s.ttlTimer != nil {
+		s.ttlTimer.Stop()
+		s.ttlTimer = nil
+	}
+	if s.ttl <= 0 {
+		return
+	}
+	s.ttlTimer = time.AfterFunc(s.ttl, s.expire)
+}
+
+func (s *Status) expire() {
+	s.Lock()
+	// timer raced with update
+	if s.ttl <= 0 || s.Stale || time.Since(s.Ts) < s.ttl {
+		s.Unlock()
+		return
+	}
+	lastUpdate := s.Ts
+	msg := "stale, never updated"
+	if !lastUpdate.IsZero() {
+		msg = "stale since " + lastUpdate.Format(time.RFC3339)
+		if s.Msg != "" {
+			msg += ", last: " + s.Msg
+		}
+	}
+	s.setState(s.staleState, msg)
+	// keep time of last real update
+	s.Ts = lastUpdate
+	s.Stale = true
+	s.Unlock()
+	s.propagate()
+}
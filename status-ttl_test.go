@@ -0,0 +1,54 @@
+package mon
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatusTTL(t *testing.T) {
+	s := NewStatus("app")
+	db := s.MustNewComponent("db")
+	web := s.MustNewComponent("web")
+	require.NoError(t, web.Update(StateOk, "running"))
+	db.SetTTL(time.Millisecond * 50)
+	require.NoError(t, db.Update(StateOk, "running"))
+	assert.Equal(t, StateOk, s.GetState())
+
+	assert.Eventually(t, func() bool { return db.GetState() == StateUnknown }, time.Second, time.Millisecond*5)
+	db.RLock()
+	assert.True(t, db.Stale)
+	assert.Contains(t, db.Msg, "stale since ")
+	assert.Contains(t, db.Msg, "last: running")
+	assert.Greater(t, time.Since(db.Ts), time.Millisecond*50, "ts is last real update")
+	db.RUnlock()
+	assert.Equal(t, StateUnknown, s.GetState(), "propagated to parent")
+	assert.Eventually(t, func() bool {
+		s.RLock()
+		defer s.RUnlock()
+		return s.State == StateUnknown
+	}, time.Second, time.Millisecond*5)
+
+	require.NoError(t, db.Update(StateOk, "running again"))
+	db.RLock()
+	assert.False(t, db.Stale, "update clears stale flag")
+	db.RUnlock()
+	assert.Equal(t, StateOk, s.GetState())
+
+	t.Run("custom state", func(t *testing.T) {
+		c := s.MustNewComponent("cache")
+		c.SetTTL(time.Millisecond*10, StateCritical)
+		assert.Eventually(t, func() bool { return c.GetState() == StateCritical }, time.Second, time.Millisecond*5)
+		assert.Equal(t, "stale, never updated", c.GetMessage())
+	})
+	t.Run("disable", func(t *testing.T) {
+		c := s.MustNewComponent("batch")
+		c.SetTTL(time.Millisecond * 10)
+		c.SetTTL(0)
+		require.NoError(t, c.Update(StateOk, "running"))
+		time.Sleep(time.Millisecond * 30)
+		assert.Equal(t, StateOk, c.GetState())
+	})
+}
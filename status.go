@@ -2,6 +2,7 @@ package mon
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -22,6 +23,14 @@ const Warning = State(2)
 const Critical = State(3)
 const Unknown = State(4)
 
+// NagiosCode returns nagios-compatible state code (ok = 0 ... unknown = 3). Invalid state is reported as unknown
+func (s State) NagiosCode() int {
+	if s == StateInvalid || s >= stateEnd {
+		return int(StateUnknown) - 1
+	}
+	return int(s) - 1
+}
+
 // Status forms hierarchical structure. Parent status code and message is always generated from status of children so running update on it is pointless
 type Status struct {
 	State State `json:"state"`
@@ -40,9 +49,18 @@ type Status struct {
 	// but fresh (all fields zero) object will be invalid (state = 0 but ok = false)
 	// and that can be detected upstream.
 	// Other function is to allow just checking one bool flag to decide if it is ok or not
-	Ok         bool               `json:"ok"`
-	Ts         time.Time          `json:"ts"`
-	Components map[string]*Status `json:"components,omitempty"`
+	Ok bool      `json:"ok"`
+	Ts time.Time `json:"ts"`
+	// set when component was not updated within its TTL
+	Stale bool `json:"stale,omitempty"`
+	// set when flap detection is enabled and component changes state too often
+	Flapping bool `json:"flapping,omitempty"`
+	// how component's state affects its parent, set via SetCriticality()
+	Criticality Criticality `json:"criticality,omitempty"`
+	// set when component is in maintenance or its problem is acknowledged, it is then not taken into account in parent's state
+	Maintenance  *Silence           `json:"maintenance,omitempty"`
+	Acknowledged *Silence           `json:"acknowledged,omitempty"`
+	Components   map[string]*Status `json:"components,omitempty"`
 	// function used to generate status and message from underlying components
 	summaryState   func(*map[string]*Status) (state State)
 	summaryMessage func(*map[string]*Status) (message string)
@@ -52,6 +70,39 @@ type Status struct {
 	updRecv chan bool
 	updSend *chan bool
 	child   bool
+	// time of last state change
+	stateTs time.Time
+	// staleness detection
+	ttl        time.Duration
+	ttlTimer   *time.Timer
+	staleState State
+	// hysteresis and flap detection
+	hysteresis   HysteresisConfig
+	stableState  State
+	stableMsg    string
+	pendingState State
+	pendingCount int
+	pendingSince time.Time
+	flap         FlapConfig
+	flapHistory  []State
+	flapPercent  float64
+	// ring buffer of state transitions
+	history    []StateTransition
+	historyPos int
+	historyLen int
+	// state change subscribers
+	events subscribers
+	parent *Status
+	// closed by Close() to stop the update goroutine
+	done      chan struct{}
+	closeOnce sync.Once
+	// maintenance/acknowledgement expiry
+	maintenanceTimer *time.Timer
+	ackTimer         *time.Timer
+	// Kubernetes probes component affects, 0 means inherited from parent
+	probes Probe
+	// set once component reports Ok, for startup probe
+	everOk bool
 }
 
 // NewStatus creates new status object with state set to unknown
@@ -73,25 +124,23 @@ func newStatus(name string, updateCh chan bool, p ...string) *Status {
 	}
 	s.Components = make(map[string]*Status)
 	s.State = StateUnknown
+	s.stateTs = time.Now()
+	s.history = make([]StateTransition, DefaultHistorySize)
 	s.Ok = false
 	s.summaryMessage = SummarizeStatusMessage
 	s.summaryState = SummarizeStatusState
 	s.updRecv = make(chan bool, 1)
+	s.done = make(chan struct{})
 	if updateCh != nil {
 		s.updSend = &updateCh
 	}
 	go func() {
-		for range s.updRecv {
-			msg := s.summaryMessage(&s.Components)
-			state := s.summaryState(&s.Components)
-			s.Lock()
-			s.Msg = msg
-			s.State = state
-			s.Ok = state == StateOk
-			s.Ts = time.Now()
-			s.Unlock()
-			if s.updSend != nil {
-				*s.updSend <- true
+		for {
+			select {
+			case <-s.updRecv:
+				s.refresh()
+			case <-s.done:
+				return
 			}
 		}
 	}()
@@ -110,18 +159,85 @@ func (s *Status) Update(status State, message string) error {
 		s.Unlock()
 		return fmt.Errorf("status[%s] have %d children nodes[], updating parent is pointless", s.Name, len(s.Components))
 	}
-	s.State = status
-	s.Msg = message
-	s.Ok = s.State == StateOk
-	s.Ts = time.Now()
+	status, message = s.filterUpdate(status, message)
+	s.setState(status, message)
+	s.Stale = false
+	s.resetTTL()
 	s.Unlock()
-	if s.updSend != nil {
-		*s.updSend <- true
-	}
+	s.propagate()
 
 	return nil
 }
 
+// refresh recalculates state and message from components and propagates it up
+func (s *Status) refresh() {
+	s.RLock()
+	summaryMessage, summaryState := s.summaryMessage, s.summaryState
+	components := s.Components
+	s.RUnlock()
+	state, msg := StateUnknown, "no components"
+	if len(components) > 0 {
+		msg = summaryMessage(&components)
+		state = summaryState(&components)
+	}
+	s.Lock()
+	s.setState(state, msg)
+	s.Unlock()
+	s.propagate()
+}
+
+// propagate notifies parent about the change. Parent only needs to know that there was an update
+// so if there is already one pending in the channel that is enough
+func (s *Status) propagate() {
+	s.RLock()
+	updSend := s.updSend
+	s.RUnlock()
+	if updSend == nil {
+		return
+	}
+	select {
+	case *updSend <- true:
+	default:
+	}
+}
+
+// setState sets state and message and records time of state change. Has to be called with lock held
+func (s *Status) setState(state State, message string) {
+	now := time.Now()
+	if state != s.State {
+		s.recordTransition(StateTransition{
+			From:     s.State,
+			To:       state,
+			Msg:      message,
+			Ts:       now,
+			Duration: now.Sub(s.stateTs),
+		})
+		s.notify(StatusEvent{
+			Name: s.Name,
+			From: s.State,
+			To:   state,
+			Msg:  message,
+			Ts:   now,
+		})
+		s.stateTs = now
+		s.clearAcknowledgement()
+	}
+	s.State = state
+	s.Msg = message
+	s.Ok = state == StateOk
+	if s.Ok {
+		s.everOk = true
+	}
+	s.Ts = now
+}
+
+// StateSince returns time of last state change
+func (s *Status) StateSince() time.Time {
+	s.RLock()
+	defer s.RUnlock()
+	return s.stateTs
+}
+
 // MustUpdate runs Update and panics on error
 //
 
@@ -144,8 +260,10 @@ func (s *Status) NewComponent(name string, p ...string) (*Status, error) {
 	if _, ok := s.Components[name]; ok {
 		return nil, fmt.Errorf("Given component already exists!")
 	}
-	s.Components[name] = newStatus(name, s.updRecv, p...)
-	return s.Components[name], nil
+	c := newStatus(name, s.updRecv, p...)
+	c.parent = s
+	s.setComponent(name, c)
+	return c, nil
 }
 
 func (s *Status) MustNewComponent(name string, p ...string) *Status {
@@ -157,22 +275,27 @@ func (s *Status) MustNewComponent(name string, p ...string) *Status {
 }
 
 // update and return message
+// Status decoded from JSON have no summary function so it returns message as received
 func (s *Status) GetMessage() string {
-	if len(s.Components) > 0 {
-		return s.summaryMessage(&s.Components)
+	s.RLock()
+	summaryMessage, components, msg := s.summaryMessage, s.Components, s.Msg
+	s.RUnlock()
+	if len(components) > 0 && summaryMessage != nil {
+		return summaryMessage(&components)
 	} else {
-		return s.Msg
+		return msg
 	}
 }
 
 // update and return message
 func (s *Status) GetState() State {
-	if len(s.Components) > 0 {
-		return s.summaryState(&s.Components)
+	s.RLock()
+	summaryState, components, state := s.summaryState, s.Components, s.State
+	s.RUnlock()
+	if len(components) > 0 && summaryState != nil {
+		return summaryState(&components)
 	} else {
-		s.RLock()
-		defer s.RUnlock()
-		return s.State
+		return state
 	}
 }
 
@@ -186,19 +309,24 @@ func (s *Status) GetOK() bool {
 	return ok
 }
 
-// SummarizeStatusState returns highest ( critical>unknown>warning>ok ) state of underlying status map
+// SummarizeStatusState returns highest ( critical>unknown>warning>ok ) state of underlying status map.
+// Optional components are capped at warning and ignored ones are skipped
 func SummarizeStatusState(component *map[string]*Status) (state State) {
+	ignored := 0
 	for _, c := range *component {
-		c.RLock()
+		cState, counted := componentState(c)
 		switch {
+		case !counted:
+			ignored++
 		// Critical state is always most important one to report; nothing to do after if we find one
-		case c.State == StateCritical:
-			c.RUnlock()
+		case cState == StateCritical:
 			return StateCritical
-		case c.State > state:
-			state = c.State
+		case cState > state:
+			state = cState
 		}
-		c.RUnlock()
+	}
+	if ignored > 0 && ignored == len(*component) {
+		return StateOk
 	}
 	return state
 }
@@ -208,9 +336,17 @@ func SummarizeStatusMessage(component *map[string]*Status) (message string) {
 	var sCritical, sWarning, sUnknown, sOk []string
 	for _, c := range *component {
 		c.RLock()
-		componentInfo := fmt.Sprintf("[%s]%s", c.Name, c.GetMessage())
+		name, state := c.Name, c.State
+		var silence string
+		switch {
+		case c.Maintenance.Active():
+			silence = " (maintenance: " + c.Maintenance.Reason + ")"
+		case c.Acknowledged.Active():
+			silence = " (acknowledged: " + c.Acknowledged.Reason + ")"
+		}
 		c.RUnlock()
-		switch c.State {
+		componentInfo := fmt.Sprintf("[%s]%s%s", name, c.GetMessage(), silence)
+		switch state {
 		case StateOk:
 			sOk = append(sOk, componentInfo)
 		case StateWarning:
@@ -236,3 +372,28 @@ func SummarizeStatusMessage(component *map[string]*Status) (message string) {
 	}
 	return strings.Join(outArr, " -=#=- ")
 }
+
+// walkStatus calls f for status and all of its components, depth-first, with path of component names relative to the root
+func walkStatus(s *Status, path []string, f func(path []string, s *Status)) {
+	f(path, s)
+	names, children := s.children()
+	for i, c := range children {
+		walkStatus(c, append(append([]string{}, path...), names[i]), f)
+	}
+}
+
+// children returns direct components sorted by name
+func (s *Status) children() (names []string, children []*Status) {
+	s.RLock()
+	defer s.RUnlock()
+	names = make([]string, 0, len(s.Components))
+	for name := range s.Components {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	children = make([]*Status, len(names))
+	for i, name := range names {
+		children[i] = s.Components[name]
+	}
+	return names, children
+}
@@ -6,6 +6,7 @@ import (
 	"math"
 	"net"
 	"os"
+	"sort"
 	"strings"
 )
 
@@ -59,11 +60,42 @@ type GobTag struct {
 	T map[string]string
 }
 
+// GobEncode encodes tags sorted by key, as gob encodes maps in random order and
+// same set of tags has to always result in same key in the registry
+func (g GobTag) GobEncode() ([]byte, error) {
+	keys := make([]string, 0, len(g.T))
+	for k := range g.T {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	kv := make([]string, 0, len(keys)*2)
+	for _, k := range keys {
+		kv = append(kv, k, g.T[k])
+	}
+	var b bytes.Buffer
+	err := gob.NewEncoder(&b).Encode(kv)
+	return b.Bytes(), err
+}
+
+// GobDecode decodes tags encoded by GobEncode
+func (g *GobTag) GobDecode(data []byte) error {
+	var kv []string
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&kv)
+	if err != nil {
+		return err
+	}
+	g.T = make(map[string]string, len(kv)/2)
+	for i := 0; i+1 < len(kv); i += 2 {
+		g.T[kv[i]] = kv[i+1]
+	}
+	return nil
+}
+
 func mapToGobTag(v ...map[string]string) GobTag {
 	d := map[string]string{}
 	for _, m := range v {
 		for k, v := range m {
-			d[k] = promLabelEscapeLabelValue(v)
+			d[k] = v
 		}
 	}
 	return GobTag{T: d}
@@ -88,6 +120,25 @@ func ungobTag(data []byte) (g GobTag) {
 
 var emptyGob = gobTag(GobTag{map[string]string{}})
 
+// gobTagLabels renders encoded tags as `key="value",...` sorted by key and escaped like in Prometheus,
+// empty if there are no tags
+func gobTagLabels(gob string) string {
+	if gob == string(emptyGob) {
+		return ""
+	}
+	tags := ungobTag([]byte(gob)).T
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	labels := make([]string, len(keys))
+	for i, k := range keys {
+		labels[i] = k + `="` + promLabelEscapeLabelValue(tags[k]) + `"`
+	}
+	return strings.Join(labels, ",")
+}
+
 func promLabelEscapeLabelValue(value string) string {
 	value = strings.ReplaceAll(value, "\\", "\\\\")
 	value = strings.ReplaceAll(value, "\"", "\\\"")
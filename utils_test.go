@@ -27,3 +27,13 @@ func TestWrapUint64Counter(t *testing.T) {
 	assert.Equal(t, int64(10), WrapUint64Counter(over10), "10 overflow")
 	assert.Equal(t, int64(math.MaxInt64), WrapUint64Counter(top), "uint64 overflow")
 }
+
+func TestGobTagDeterministic(t *testing.T) {
+	tags := map[string]string{"a": "1", "b": "2", "c": "3", "d": "4", "e": "5"}
+	key := string(gobTag(mapToGobTag(tags)))
+	for i := 0; i < 20; i++ {
+		assert.Equal(t, key, string(gobTag(mapToGobTag(tags))))
+	}
+	assert.Equal(t, tags, ungobTag([]byte(key)).T)
+	assert.Equal(t, map[string]string{}, ungobTag(emptyGob).T)
+}
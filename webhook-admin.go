@@ -0,0 +1,217 @@
+package mon
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// AdminConfig configures admin endpoint
+type AdminConfig struct {
+	// Auth authorizes request and returns name of the user (recorded as Silence.By).
+	// Use AdminBasicAuth()/AdminBearerToken() or your own. If nil all requests are rejected
+	Auth func(req *http.Request) (user string, ok bool)
+}
+
+// AdminBasicAuth returns Auth function checking HTTP basic auth against given user and password.
+// Empty password rejects all requests
+func AdminBasicAuth(user string, password string) func(req *http.Request) (string, bool) {
+	return func(req *http.Request) (string, bool) {
+		u, p, ok := req.BasicAuth()
+		if !ok || password == "" {
+			return "", false
+		}
+		userOk := subtle.ConstantTimeCompare([]byte(u), []byte(user)) == 1
+		passOk := subtle.ConstantTimeCompare([]byte(p), []byte(password)) == 1
+		return u, userOk && passOk
+	}
+}
+
+// AdminBearerToken returns Auth function checking `Authorization: Bearer <token>` header
+func AdminBearerToken(token string) func(req *http.Request) (string, bool) {
+	return func(req *http.Request) (string, bool) {
+		t, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			return "", false
+		}
+		return "", subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1
+	}
+}
+
+// AdminRequest changes maintenance/acknowledgement of the component
+type AdminRequest struct {
+	// path to the component, separated by `/`. Empty for the status itself
+	Component string `json:"component"`
+	// maintenance, ack, clear-maintenance, clear-ack or clear (both)
+	Action string `json:"action"`
+	Reason string `json:"reason"`
+	// expiry, either as duration (like `2h`) or time. If both are empty it does not expire
+	Duration string    `json:"duration"`
+	Until    time.Time `json:"until"`
+}
+
+// AdminSilence is entry in the list returned by GET to admin endpoint
+type AdminSilence struct {
+	Component    string   `json:"component"`
+	State        State    `json:"state"`
+	Maintenance  *Silence `json:"maintenance,omitempty"`
+	Acknowledged *Silence `json:"acknowledged,omitempty"`
+}
+
+// HandleAdmin returns handler managing maintenance and acknowledgements of status components.
+//
+// GET returns list of components in maintenance or acknowledged, POST with AdminRequest (as JSON or form fields) changes them:
+//
+//	curl -u admin:pass -d component=db -d action=maintenance -d reason="pg upgrade" -d duration=2h http://127.0.0.1:8080/_status/admin
+func HandleAdmin(s *Status, cfg AdminConfig) func(w http.ResponseWriter, req *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		handleAdmin(w, req, s, cfg)
+	}
+}
+
+func handleAdmin(w http.ResponseWriter, req *http.Request, s *Status, cfg AdminConfig) {
+	if cfg.Auth == nil {
+		http.Error(w, "admin endpoint has no authentication configured", http.StatusForbidden)
+		return
+	}
+	user, ok := cfg.Auth(req)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Basic realm="go-mon"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	switch req.Method {
+	case http.MethodGet:
+		silences := []AdminSilence{}
+		walkStatus(s, nil, func(path []string, c *Status) {
+			c.RLock()
+			defer c.RUnlock()
+			if c.silenced() {
+				silences = append(silences, AdminSilence{
+					Component:    strings.Join(path, "/"),
+					State:        c.State,
+					Maintenance:  activeSilence(c.Maintenance),
+					Acknowledged: activeSilence(c.Acknowledged),
+				})
+			}
+		})
+		writeAdminJSON(w, http.StatusOK, silences)
+	case http.MethodPost:
+		r, err := parseAdminRequest(req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		c, err := findComponent(s, r.Component)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		switch r.Action {
+		case "maintenance", "ack":
+			if r.Reason == "" {
+				http.Error(w, "reason is required", http.StatusBadRequest)
+				return
+			}
+			until := r.Until
+			if r.Duration != "" {
+				d, err := time.ParseDuration(r.Duration)
+				if err != nil || d <= 0 {
+					http.Error(w, fmt.Sprintf("invalid duration [%s]", r.Duration), http.StatusBadRequest)
+					return
+				}
+				until = time.Now().Add(d)
+			}
+			if r.Action == "maintenance" {
+				err = c.SetMaintenance(r.Reason, until, user)
+			} else {
+				err = c.Acknowledge(r.Reason, until, user)
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		case "clear-maintenance":
+			c.ClearMaintenance()
+		case "clear-ack":
+			c.ClearAcknowledgement()
+		case "clear":
+			c.ClearMaintenance()
+			c.ClearAcknowledgement()
+		default:
+			http.Error(w, fmt.Sprintf("unknown action [%s]", r.Action), http.StatusBadRequest)
+			return
+		}
+		c.RLock()
+		resp := AdminSilence{
+			Component:    r.Component,
+			State:        c.State,
+			Maintenance:  activeSilence(c.Maintenance),
+			Acknowledged: activeSilence(c.Acknowledged),
+		}
+		c.RUnlock()
+		writeAdminJSON(w, http.StatusOK, resp)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func parseAdminRequest(req *http.Request) (r AdminRequest, err error) {
+	if strings.HasPrefix(req.Header.Get("Content-Type"), "application/json") {
+		err = json.NewDecoder(io.LimitReader(req.Body, 1<<16)).Decode(&r)
+		if err != nil {
+			return r, fmt.Errorf("error decoding request: %s", err)
+		}
+		return r, nil
+	}
+	r.Component = req.FormValue("component")
+	r.Action = req.FormValue("action")
+	r.Reason = req.FormValue("reason")
+	r.Duration = req.FormValue("duration")
+	if until := req.FormValue("until"); until != "" {
+		r.Until, err = time.Parse(time.RFC3339, until)
+		if err != nil {
+			return r, fmt.Errorf("invalid until [%s], should be RFC3339", until)
+		}
+	}
+	return r, nil
+}
+
+// findComponent finds component by `/` separated path
+func findComponent(s *Status, path string) (*Status, error) {
+	c := s
+	for _, name := range strings.Split(strings.Trim(path, "/"), "/") {
+		if name == "" {
+			continue
+		}
+		next, ok := c.GetComponent(name)
+		if !ok {
+			return nil, fmt.Errorf("component [%s] not found", path)
+		}
+		c = next
+	}
+	return c, nil
+}
+
+func activeSilence(m *Silence) *Silence {
+	if !m.Active() {
+		return nil
+	}
+	return m
+}
+
+func writeAdminJSON(w http.ResponseWriter, code int, v interface{}) {
+	js, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(js)
+}
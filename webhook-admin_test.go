@@ -0,0 +1,115 @@
+package mon
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func adminRequest(t *testing.T, handler func(http.ResponseWriter, *http.Request), method string, form url.Values, auth func(*http.Request)) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, "/_status/admin", strings.NewReader(form.Encode()))
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if auth != nil {
+		auth(req)
+	}
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	return rr
+}
+
+func TestHandleAdmin(t *testing.T) {
+	s := NewStatus("app")
+	db := s.MustNewComponent("db")
+	replica := db.MustNewComponent("replica")
+	db.MustNewComponent("primary").MustUpdate(StateOk, "ok")
+	replica.MustUpdate(StateCritical, "down")
+	handler := HandleAdmin(s, AdminConfig{Auth: AdminBasicAuth("admin", "secret")})
+	basic := func(req *http.Request) { req.SetBasicAuth("admin", "secret") }
+
+	rr := adminRequest(t, handler, "GET", nil, nil)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	rr = adminRequest(t, handler, "GET", nil, func(req *http.Request) { req.SetBasicAuth("admin", "wrong") })
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	rr = adminRequest(t, handler, "POST", url.Values{
+		"component": {"db/replica"},
+		"action":    {"maintenance"},
+		"reason":    {"resync"},
+		"duration":  {"2h"},
+	}, basic)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.True(t, replica.InMaintenance())
+	assert.Equal(t, "admin", replica.Maintenance.By)
+	assert.WithinDuration(t, time.Now().Add(time.Hour*2), replica.Maintenance.Until, time.Minute)
+	assert.Equal(t, StateOk, db.GetState())
+
+	rr = adminRequest(t, handler, "GET", nil, basic)
+	require.Equal(t, http.StatusOK, rr.Code)
+	var silences []AdminSilence
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &silences))
+	require.Len(t, silences, 1)
+	assert.Equal(t, "db/replica", silences[0].Component)
+	assert.Equal(t, StateCritical, silences[0].State)
+	assert.Equal(t, "resync", silences[0].Maintenance.Reason)
+
+	rr = adminRequest(t, handler, "POST", url.Values{"component": {"db/replica"}, "action": {"clear"}}, basic)
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.False(t, replica.InMaintenance())
+
+	for _, tc := range []struct {
+		form url.Values
+		code int
+	}{
+		{url.Values{"component": {"db/nope"}, "action": {"clear"}}, http.StatusNotFound},
+		{url.Values{"component": {"db"}, "action": {"nope"}}, http.StatusBadRequest},
+		{url.Values{"component": {"db"}, "action": {"ack"}}, http.StatusBadRequest},
+		{url.Values{"component": {"db"}, "action": {"ack"}, "reason": {"x"}, "duration": {"-1h"}}, http.StatusBadRequest},
+		{url.Values{"component": {"db"}, "action": {"ack"}, "reason": {"x"}, "until": {"tomorrow"}}, http.StatusBadRequest},
+		{url.Values{"component": {"db"}, "action": {"maintenance"}, "reason": {"x"}, "until": {"2001-01-01T00:00:00Z"}}, http.StatusBadRequest},
+	} {
+		rr = adminRequest(t, handler, "POST", tc.form, basic)
+		assert.Equal(t, tc.code, rr.Code, tc.form.Encode())
+	}
+	rr = adminRequest(t, handler, "DELETE", nil, basic)
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+}
+
+func TestHandleAdminJSON(t *testing.T) {
+	s := NewStatus("app")
+	db := s.MustNewComponent("db")
+	db.MustUpdate(StateCritical, "down")
+	handler := HandleAdmin(s, AdminConfig{Auth: AdminBearerToken("token")})
+	req := httptest.NewRequest("POST", "/_status/admin", strings.NewReader(`{"component":"db","action":"ack","reason":"on it"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer token")
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.True(t, db.IsAcknowledged())
+	assert.Contains(t, rr.Body.String(), `"reason":"on it"`)
+}
+
+func TestHandleAdminNoAuth(t *testing.T) {
+	rr := adminRequest(t, HandleAdmin(NewStatus("app"), AdminConfig{}), "GET", nil, nil)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+}
+
+func TestAdminAuthEmptySecret(t *testing.T) {
+	handler := HandleAdmin(NewStatus("app"), AdminConfig{Auth: AdminBasicAuth("admin", "")})
+	rr := adminRequest(t, handler, "GET", nil, func(req *http.Request) { req.SetBasicAuth("admin", "") })
+	assert.Equal(t, http.StatusUnauthorized, rr.Code, "unset password does not open the endpoint")
+
+	handler = HandleAdmin(NewStatus("app"), AdminConfig{Auth: AdminBearerToken("")})
+	rr = adminRequest(t, handler, "GET", nil, func(req *http.Request) { req.Header.Set("Authorization", "Bearer ") })
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
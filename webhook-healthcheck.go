@@ -0,0 +1,132 @@
+package mon
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// HealthcheckBody is format of healthcheck response body
+type HealthcheckBody int
+
+const (
+	// HealthcheckBodyJSON returns whole status tree as JSON
+	HealthcheckBodyJSON = HealthcheckBody(iota)
+	// HealthcheckBodyText returns single `STATE - message` line, for nginx, Consul and other checkers that only look at HTTP code
+	HealthcheckBodyText
+	// HealthcheckBodyNone returns only HTTP code and headers
+	HealthcheckBodyNone
+)
+
+// defaultHealthcheckCodes maps state to HTTP code returned by healthcheck
+var defaultHealthcheckCodes = map[State]int{
+	StateInvalid:  http.StatusInternalServerError,
+	StateOk:       http.StatusOK,
+	StateWarning:  http.StatusOK,
+	StateCritical: http.StatusServiceUnavailable,
+	StateUnknown:  http.StatusInternalServerError,
+}
+
+// HealthcheckConfig configures healthcheck handler
+type HealthcheckConfig struct {
+	// Status to return, defaults to GlobalStatus
+	Status *Status
+	// HTTP code returned in each state. States not in the map return 200 for Ok and Warning,
+	// 503 for Critical and 500 for Unknown and Invalid
+	Codes map[State]int
+	// Headers added to response in each state
+	Headers map[State]http.Header
+	// Format of response body, defaults to JSON
+	Body HealthcheckBody
+	// If set, `X-Haproxy-Server-State` header sent by haproxy's `http-check send-state` is parsed into it
+	// and state of LB nodes is included in JSON
+	Haproxy *HaproxyState
+}
+
+// HealthcheckHaproxyNOLB returns config returning 404 on Warning, which haproxy's `http-check disable-on-404` treats as NOLB (drain)
+func HealthcheckHaproxyNOLB() HealthcheckConfig {
+	return HealthcheckConfig{
+		Codes: map[State]int{StateWarning: http.StatusNotFound},
+	}
+}
+
+// HealthcheckEnvoy returns config with Envoy's semantics: Warning is returned as 200 with `x-envoy-degraded` header (host is marked degraded),
+// Critical, Unknown and Invalid with `x-envoy-immediate-health-check-fail` so Envoy fails the host without waiting for unhealthy threshold
+func HealthcheckEnvoy() HealthcheckConfig {
+	fail := http.Header{"X-Envoy-Immediate-Health-Check-Fail": {"true"}}
+	return HealthcheckConfig{
+		Headers: map[State]http.Header{
+			StateWarning:  {"X-Envoy-Degraded": {"true"}},
+			StateCritical: fail,
+			StateUnknown:  fail,
+			StateInvalid:  fail,
+		},
+	}
+}
+
+// HandleHealthcheckWith returns healthcheck handler with given HTTP codes, headers and body format
+//
+//	http.HandleFunc("/_status/envoy", mon.HandleHealthcheckWith(mon.HealthcheckEnvoy()))
+//	http.HandleFunc("/_status/ping", mon.HandleHealthcheckWith(mon.HealthcheckConfig{Body: mon.HealthcheckBodyText}))
+func HandleHealthcheckWith(cfg HealthcheckConfig) func(w http.ResponseWriter, req *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		handleHealthcheck(w, req, cfg)
+	}
+}
+
+func handleHealthcheck(w http.ResponseWriter, req *http.Request, cfg HealthcheckConfig) {
+	s := cfg.Status
+	if s == nil {
+		s = GlobalStatus
+	}
+	if cfg.Haproxy != nil {
+		newState, _, err := HandleHaproxyState(req)
+		if err == nil {
+			cfg.Haproxy.update(&newState)
+		}
+	}
+	state := s.GetState()
+	httpStatus, ok := cfg.Codes[state]
+	if !ok {
+		httpStatus = healthcheckHTTPStatus(state)
+	}
+	for k, v := range cfg.Headers[state] {
+		for _, value := range v {
+			w.Header().Add(k, value)
+		}
+	}
+
+	switch cfg.Body {
+	case HealthcheckBodyNone:
+		w.WriteHeader(httpStatus)
+	case HealthcheckBodyText:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(httpStatus)
+		w.Write([]byte(nagiosStateName(state) + " - " + strings.ReplaceAll(s.GetMessage(), "\n", " ") + "\n"))
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		var status interface{} = s
+		if wantHistory(req) {
+			status = s.withHistory()
+		}
+		if cfg.Haproxy != nil {
+			status = withHaproxy(status, cfg.Haproxy.Nodes())
+		}
+		js, err := json.Marshal(status)
+		if err != nil {
+			http.Error(w, err.Error(), httpStatus)
+			return
+		} else if httpStatus != http.StatusOK {
+			w.WriteHeader(httpStatus)
+		}
+		w.Write(js)
+	}
+}
+
+// healthcheckHTTPStatus maps state to HTTP code returned by healthcheck
+func healthcheckHTTPStatus(state State) int {
+	if code, ok := defaultHealthcheckCodes[state]; ok {
+		return code
+	}
+	return http.StatusServiceUnavailable
+}
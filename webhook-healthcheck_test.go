@@ -0,0 +1,72 @@
+package mon
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func healthcheck(t *testing.T, handler func(w http.ResponseWriter, req *http.Request)) *httptest.ResponseRecorder {
+	req, err := http.NewRequest("GET", "/health", nil)
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	return rr
+}
+
+func TestHandleHealthcheckWithEnvoy(t *testing.T) {
+	s := NewStatus("app")
+	cfg := HealthcheckEnvoy()
+	cfg.Status = s
+	handler := HandleHealthcheckWith(cfg)
+
+	s.MustUpdate(StateOk, "ok")
+	rr := healthcheck(t, handler)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Empty(t, rr.Header().Get("X-Envoy-Degraded"))
+	assert.Empty(t, rr.Header().Get("X-Envoy-Immediate-Health-Check-Fail"))
+
+	s.MustUpdate(StateWarning, "slow")
+	rr = healthcheck(t, handler)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "true", rr.Header().Get("X-Envoy-Degraded"))
+
+	s.MustUpdate(StateCritical, "down")
+	rr = healthcheck(t, handler)
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Equal(t, "true", rr.Header().Get("X-Envoy-Immediate-Health-Check-Fail"))
+	assert.Contains(t, rr.Body.String(), `"msg":"down"`)
+}
+
+func TestHandleHealthcheckWithText(t *testing.T) {
+	s := NewStatus("app")
+	s.MustNewComponent("db").MustUpdate(StateCritical, "connection\nrefused")
+	handler := HandleHealthcheckWith(HealthcheckConfig{
+		Status: s,
+		Body:   HealthcheckBodyText,
+		Codes:  map[State]int{StateCritical: http.StatusTeapot},
+	})
+	rr := healthcheck(t, handler)
+	assert.Equal(t, http.StatusTeapot, rr.Code)
+	assert.Equal(t, "text/plain; charset=utf-8", rr.Header().Get("Content-Type"))
+	assert.Equal(t, "CRITICAL - C:[db]connection refused\n", rr.Body.String())
+
+	rr = healthcheck(t, HandleHealthcheckWith(HealthcheckConfig{Status: s, Body: HealthcheckBodyNone}))
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Empty(t, rr.Body.String())
+}
+
+func TestHandleHealthcheckWithHaproxyNOLB(t *testing.T) {
+	withTestGlobalStatus(t)
+	cfg := HealthcheckHaproxyNOLB()
+	cfg.Haproxy = &HaproxyState{}
+	handler := HandleHealthcheckWith(cfg)
+	GlobalStatus.Update(StateWarning, "shutting down")
+	rr := haproxyCheck(t, handler, "/", "UP 2/3; name=bck/srv2; node=lb1; weight=1/2; scur=3/22; qcur=0")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"haproxy":[{"node":"lb1"`)
+	assert.False(t, cfg.Haproxy.SafeToStop())
+}
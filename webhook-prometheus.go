@@ -3,8 +3,10 @@ package mon
 import (
 	"fmt"
 	"github.com/XANi/goneric"
+	"io"
 	"net/http"
 	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -16,6 +18,7 @@ var prometheusTypes = map[string]string{
 	MetricTypeGaugeInt:     "gauge",
 	MetricTypeCounter:      "counter",
 	MetricTypeCounterFloat: "counter",
+	MetricTypeHistogram:    "histogram",
 }
 var promRepl = strings.NewReplacer(
 	".", ":",
@@ -32,6 +35,7 @@ func handlePrometheus(w http.ResponseWriter, req *http.Request, registry *Regist
 		for k2, metric := range m1 {
 			k = promRepl.Replace(k)
 			t := ""
+			var tagSlice []string
 			keyName := k
 			metricType := metric.Type()
 			metricUnit := metric.Unit()
@@ -45,9 +49,9 @@ func handlePrometheus(w http.ResponseWriter, req *http.Request, registry *Regist
 
 			if k2 != string(emptyGob) {
 				tags := ungobTag([]byte(k2))
-				tagSlice := goneric.MapToSlice(
+				tagSlice = goneric.MapToSlice(
 					func(k string, v string) string {
-						return k + "=" + `"` + v + `"`
+						return k + "=" + `"` + promLabelEscapeLabelValue(v) + `"`
 					},
 					tags.T)
 				// prometheus guys decided sorting order is important part of metric:
@@ -67,8 +71,28 @@ func handlePrometheus(w http.ResponseWriter, req *http.Request, registry *Regist
 				emittedHelp[keyName] = true
 			}
 
+			if h, ok := metric.(Histogram); ok {
+				writePrometheusHistogram(w, keyName, tagSlice, h.HistogramSnapshot())
+				continue
+			}
 			fmt.Fprintf(w, "%s%s %f\n", keyName, t, metric.Value())
 
 		}
 	}
 }
+
+func writePrometheusHistogram(w io.Writer, keyName string, tagSlice []string, h HistogramSnapshot) {
+	withLe := func(le string) string {
+		return "{" + strings.Join(append(append([]string{}, tagSlice...), `le="`+le+`"`), ",") + "}"
+	}
+	t := ""
+	if len(tagSlice) > 0 {
+		t = "{" + strings.Join(tagSlice, ",") + "}"
+	}
+	for i, b := range h.Buckets {
+		fmt.Fprintf(w, "%s_bucket%s %d\n", keyName, withLe(strconv.FormatFloat(b, 'g', -1, 64)), h.Counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket%s %d\n", keyName, withLe("+Inf"), h.Count)
+	fmt.Fprintf(w, "%s_sum%s %f\n", keyName, t, h.Sum)
+	fmt.Fprintf(w, "%s_count%s %d\n", keyName, t, h.Count)
+}
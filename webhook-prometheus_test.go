@@ -67,4 +67,30 @@ func TestHandlePrometheusTags(t *testing.T) {
 	assert.Contains(t, rr.Body.String(), "# UNIT promtest_name_list_cake cake\n")
 	assert.Contains(t, rr.Body.String(), `promtest_name_list_cake{k1="v1",k2="v2"} 10.`)
 
+	r.MustRegister("promtest_path", NewGauge(), map[string]string{"path": "C:\\tmp \"x\"\n"}).Update(1)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Contains(t, rr.Body.String(), `promtest_path{path="C:\\tmp \"x\"\n"} 1`, "label value escaped once")
+}
+
+func TestHandlePrometheusHistogram(t *testing.T) {
+	r, err := NewRegistry("", "", 10)
+	require.NoError(t, err)
+	metric, err := r.RegisterOrGet("promtest.latency", NewHistogram([]float64{0.1, 1}, "seconds"), map[string]string{"k1": "v1"})
+	require.NoError(t, err)
+	metric.Update(0.05)
+	metric.Update(0.5)
+	metric.Update(5)
+
+	req, err := http.NewRequest("GET", "/metrics", nil)
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	handlePrometheus(rr, req, r)
+
+	assert.Contains(t, rr.Body.String(), "# TYPE promtest:latency_seconds histogram\n")
+	assert.Contains(t, rr.Body.String(), `promtest:latency_seconds_bucket{k1="v1",le="0.1"} 1`+"\n")
+	assert.Contains(t, rr.Body.String(), `promtest:latency_seconds_bucket{k1="v1",le="1"} 2`+"\n")
+	assert.Contains(t, rr.Body.String(), `promtest:latency_seconds_bucket{k1="v1",le="+Inf"} 3`+"\n")
+	assert.Contains(t, rr.Body.String(), `promtest:latency_seconds_sum{k1="v1"} 5.55`)
+	assert.Contains(t, rr.Body.String(), `promtest:latency_seconds_count{k1="v1"} 3`+"\n")
 }
@@ -24,57 +24,7 @@ func HandleMetrics(w http.ResponseWriter, req *http.Request) {
 
 // HandleHealthchecks returns GlobalStatus with appropriate HTTP code
 func HandleHealthcheck(w http.ResponseWriter, req *http.Request) {
-	var httpStatus int
-	w.Header().Set("Content-Type", "application/json")
-	switch GlobalStatus.GetState() {
-	case StateOk:
-		httpStatus = http.StatusOK
-	case StateWarning:
-		httpStatus = http.StatusOK
-	case StateUnknown:
-		httpStatus = http.StatusInternalServerError
-	case StateInvalid:
-		httpStatus = http.StatusInternalServerError
-	default:
-		httpStatus = http.StatusServiceUnavailable
-	}
-
-	js, err := json.Marshal(GlobalStatus)
-
-	if err != nil {
-		http.Error(w, err.Error(), httpStatus)
-		return
-	} else if httpStatus != http.StatusOK {
-		w.WriteHeader(httpStatus)
-	}
-	w.Write(js)
-}
-
-// haproxy-specific handler, there is a mode where 404 means "switch backend into NOLB mode"
-func handleHealthcheckHaproxy(w http.ResponseWriter, req *http.Request) {
-	var httpStatus int
-	w.Header().Set("Content-Type", "application/json")
-	switch GlobalStatus.GetState() {
-	case StateOk:
-		httpStatus = http.StatusOK
-	case StateWarning:
-		httpStatus = http.StatusNotFound
-	case StateUnknown:
-		httpStatus = http.StatusInternalServerError
-	case StateInvalid:
-		httpStatus = http.StatusInternalServerError
-	default:
-		httpStatus = http.StatusServiceUnavailable
-	}
-
-	js, err := json.Marshal(GlobalStatus)
-	if err != nil {
-		http.Error(w, err.Error(), httpStatus)
-		return
-	} else if httpStatus != http.StatusOK {
-		w.WriteHeader(httpStatus)
-	}
-	w.Write(js)
+	handleHealthcheck(w, req, HealthcheckConfig{})
 }
 
 type HaproxyState struct {
@@ -94,6 +44,11 @@ type HaproxyState struct {
 	Found bool
 	TS    time.Time
 	sync.RWMutex
+	// state as seen by each LB node, see Nodes()
+	nodes      map[string]*HaproxyNodeState
+	nodesSeen  bool
+	nodeExpiry time.Duration
+	registry   *Registry
 }
 
 // SafeToStop returns whether it is safe to shutdown the server.
@@ -102,10 +57,16 @@ type HaproxyState struct {
 // * server is not in UP state
 // * there is no active or queued connections to it
 // * there is no haproxy server state header present
+//
+// If more than one LB node is checking the server, all of them have to agree; nodes that did not check
+// for longer than node expiry (see SetNodeExpiry()) are ignored. If all of them expired nothing routes to us anymore
 
 func (s *HaproxyState) SafeToStop() bool {
 	s.RLock()
 	defer s.RUnlock()
+	if s.nodesSeen {
+		return s.nodesSafeToStop()
+	}
 	if s.State == Ok {
 		return false
 	}
@@ -118,11 +79,15 @@ func (s *HaproxyState) SafeToStop() bool {
 	return false
 }
 
-func (s *HaproxyState) update(new HaproxyState) {
+func (s *HaproxyState) update(new *HaproxyState) {
 	s.Lock()
 	defer s.Unlock()
-	// do not update if state is fresh and we haven't found a header in new version
-	if s.Found && !new.Found && time.Now().Sub(new.TS) < time.Minute {
+	if new.Found {
+		s.updateNode(new)
+	}
+	// do not update if state is fresh and we haven't found a header in new version.
+	// Freshness is checked on current state, as HandleHaproxyState() returns zero timestamp when there is no header
+	if s.Found && !new.Found && time.Since(s.TS) < time.Minute {
 		return
 	}
 
@@ -212,24 +177,14 @@ func HandleHaproxyState(req *http.Request) (haproxyState HaproxyState, found boo
 	return s, true, nil
 }
 
-// HandleHealthchecksHaproxy returns GlobalStatus with appropriate HTTP code and handles X-Haproxy-Server-State header
+// HandleHealthchecksHaproxy returns GlobalStatus with appropriate HTTP code and handles X-Haproxy-Server-State header.
+// With emit404OnWarning Warning is returned as 404, which haproxy's `http-check disable-on-404` treats as NOLB (drain).
+// Use HandleHealthcheckWith() to handle haproxy header with other settings
 func HandleHealthchecksHaproxy(emit404OnWarning ...bool) (handlerFunc func(w http.ResponseWriter, req *http.Request), haproxyState *HaproxyState) {
-	var state = &HaproxyState{}
+	cfg := HealthcheckConfig{}
 	if len(emit404OnWarning) >= 1 && emit404OnWarning[0] {
-		return func(w http.ResponseWriter, req *http.Request) {
-			newState, _, err := HandleHaproxyState(req)
-			if err == nil {
-				state.update(newState)
-			}
-			handleHealthcheckHaproxy(w, req)
-		}, state
-	} else {
-		return func(w http.ResponseWriter, req *http.Request) {
-			newState, _, err := HandleHaproxyState(req)
-			if err == nil {
-				state.update(newState)
-			}
-			HandleHealthcheck(w, req)
-		}, state
+		cfg = HealthcheckHaproxyNOLB()
 	}
+	cfg.Haproxy = &HaproxyState{}
+	return HandleHealthcheckWith(cfg), cfg.Haproxy
 }
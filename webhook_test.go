@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -32,6 +33,27 @@ func TestMetricsHandler(t *testing.T) {
 	assert.Contains(t, rr.Body.String(), "go_gc_heap_idle", "contains data")
 }
 
+func TestMetricsHandlerLabels(t *testing.T) {
+	GlobalRegistry.MustRegister("test.room", NewGauge(), map[string]string{"floor": "1", "building": `"A"`}).Update(23.4)
+	GlobalRegistry.MustRegister("test.room", NewGauge()).Update(21)
+	t.Cleanup(func() {
+		GlobalRegistry.Unregister("test.room", map[string]string{"floor": "1", "building": `"A"`})
+		GlobalRegistry.Unregister("test.room")
+	})
+	rr := httptest.NewRecorder()
+	HandleMetrics(rr, httptest.NewRequest("GET", "/_status/metrics", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	var out struct {
+		Metrics map[string]map[string]struct {
+			Value float64 `json:"value"`
+		} `json:"metrics"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &out))
+	assert.Equal(t, 21.0, out.Metrics["test.room"][""].Value, "series without labels under empty key")
+	assert.Equal(t, 23.4, out.Metrics["test.room"][`building="\"A\"",floor="1"`].Value, "labels sorted by key and escaped")
+	assert.Len(t, out.Metrics["test.room"], 2)
+}
+
 func TestStatusHandler(t *testing.T) {
 	// Create a request to pass to our handler. We don't have any query parameters for now, so we'll
 	// pass 'nil' as the third parameter.
@@ -191,3 +213,29 @@ func TestHandleHealthchecksHaproxy(t *testing.T) {
 	assert.Contains(t, rr.Body.String(), `"state":1`, "state body")
 	assert.Contains(t, rr.Body.String(), "service-running")
 }
+
+func TestHaproxyStateUpdateWithoutHeader(t *testing.T) {
+	var state HaproxyState
+	withHeader, err := http.NewRequest("GET", "/health", nil)
+	require.NoError(t, err)
+	withHeader.Header.Add("X-Haproxy-Server-State", "UP 2/3; name=bck/srv2; node=lb1; weight=1/2; scur=3/22; qcur=0")
+	withoutHeader, err := http.NewRequest("GET", "/health", nil)
+	require.NoError(t, err)
+
+	s, _, err := HandleHaproxyState(withHeader)
+	require.NoError(t, err)
+	state.update(&s)
+	// e.g. someone running curl against healthcheck
+	s, found, err := HandleHaproxyState(withoutHeader)
+	require.NoError(t, err)
+	require.False(t, found)
+	state.update(&s)
+	assert.True(t, state.Found, "fresh state is kept")
+	assert.Equal(t, "lb1", state.LBNodeName)
+	assert.False(t, state.SafeToStop())
+
+	state.TS = time.Now().Add(-time.Minute * 2)
+	state.update(&s)
+	assert.False(t, state.Found, "stale state is replaced")
+	assert.False(t, state.SafeToStop(), "lb1 still reported UP recently")
+}